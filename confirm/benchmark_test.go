@@ -2,6 +2,7 @@ package confirm
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -64,6 +65,7 @@ func BenchmarkTimer(b *testing.B) {
 
 	GOTO_FINISH:
 		timer.Stop()
+		cancel()
 	}
 }
 
@@ -91,6 +93,7 @@ func BenchmarkSleep(b *testing.B) {
 			}
 		}
 	GOTO_FINISH:
+		cancel()
 	}
 }
 
@@ -117,3 +120,78 @@ func BenchmarkAtomic(b *testing.B) {
 		timer.Stop()
 	}
 }
+
+// BenchmarkPending measures the cost of ticking over 100k entries not due yet,
+// the tick confirming the due entry among them,
+// and the latency until the due entry gets confirmed by workers.
+// Run for both of the single and the batch confirmation.
+func BenchmarkPending(b *testing.B) {
+	b.Run("Single", func(b *testing.B) { benchmarkPending(b, &MockClient{}) })
+	b.Run("Batch", func(b *testing.B) { benchmarkPending(b, &MockBatchClient{}) })
+}
+
+func benchmarkPending(b *testing.B, client Client) {
+	const pending = 100_000
+
+	var (
+		ctx       = context.Background()
+		confirmed = make(chan string, 1)
+	)
+
+	c := NewConfirmer(client, 2*pending, WithConfirmationInterval(3600), WithWorkers(1),
+		WithAfterTxConfirmed(func(hash string) error {
+			confirmed <- hash
+			return nil
+		}))
+
+	for i := 0; i < pending; i++ {
+		if err := c.EnqueueTxHash(ctx, fmt.Sprintf("0x%x", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// schedules the entry checked an interval ago
+	enqueueDue := func(hash string) {
+		e := newEntry(hash, time.Now().Add(-c.confirmationInterval).UnixNano())
+		c.slots.reserve(ctx, false)
+		c.index.track(e)
+		c.queue.push(e, c.nextCheck(e))
+	}
+
+	b.Run("Idle", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if c.tick(ctx) != 0 {
+				b.Fatal("ticked not due entry")
+			}
+		}
+	})
+
+	b.Run("Tick", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			hash := fmt.Sprintf("0xtick%x", n)
+			b.StopTimer()
+			enqueueDue(hash)
+			b.StartTimer()
+			c.tick(ctx)
+			if got := <-confirmed; got != hash {
+				b.Fatalf("confirmed %s, want %s", got, hash)
+			}
+		}
+	})
+
+	b.Run("Latency", func(b *testing.B) {
+		if err := c.Start(ctx); err != nil {
+			b.Fatal(err)
+		}
+		defer c.Shutdown(ctx)
+
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			hash := fmt.Sprintf("0xdue%x", n)
+			enqueueDue(hash)
+			if got := <-confirmed; got != hash {
+				b.Fatalf("confirmed %s, want %s", got, hash)
+			}
+		}
+	})
+}
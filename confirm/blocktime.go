@@ -0,0 +1,46 @@
+package confirm
+
+import (
+	"sync"
+	"time"
+)
+
+// blockTimeWeight is the weight of the latest sample in the moving average
+const blockTimeWeight = 0.2
+
+// blockTime learns the average block time from heads observed
+type blockTime struct {
+	sync.Mutex
+
+	head uint64
+	at   int64 // unix nano, the head is observed first
+	avg  time.Duration
+}
+
+// observe records the head seen at the time, sampling the block time when advanced
+func (b *blockTime) observe(head uint64, now int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	if head <= b.head {
+		return
+	}
+
+	if b.head > 0 && now > b.at {
+		sample := time.Duration((now - b.at) / int64(head-b.head))
+		if b.avg == 0 {
+			b.avg = sample
+		} else {
+			b.avg += time.Duration(blockTimeWeight * float64(sample-b.avg))
+		}
+	}
+	b.head, b.at = head, now
+}
+
+// estimate returns the latest head and the average block time, zero until learned
+func (b *blockTime) estimate() (uint64, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.head, b.avg
+}
@@ -0,0 +1,36 @@
+package confirm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockTime(t *testing.T) {
+	var (
+		b   blockTime
+		sec = int64(time.Second)
+	)
+
+	b.observe(10, 100*sec)
+	head, avg := b.estimate()
+	require.Equal(t, uint64(10), head)
+	require.Zero(t, avg)
+
+	// not sampled unless advanced
+	b.observe(10, 110*sec)
+	b.observe(9, 110*sec)
+	_, avg = b.estimate()
+	require.Zero(t, avg)
+
+	b.observe(12, 124*sec)
+	head, avg = b.estimate()
+	require.Equal(t, uint64(12), head)
+	require.Equal(t, 12*time.Second, avg)
+
+	// moved by the weight
+	b.observe(13, 126*sec)
+	_, avg = b.estimate()
+	require.Equal(t, 10*time.Second, avg)
+}
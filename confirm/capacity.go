@@ -0,0 +1,67 @@
+package confirm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// slots bounds the entries tracked to the queue size, so that requeueing never overflows.
+// A slot is reserved before sending, and released when the entry leaves the queue for good.
+// Resumed entries are accepted already, so that counted beyond the size if overflowed.
+type slots struct {
+	free chan struct{}
+	over *int64 // reserved beyond the size, released first
+}
+
+func newSlots(size int) slots {
+	return slots{free: make(chan struct{}, size), over: new(int64)}
+}
+
+// reserve waits for a free slot until the ctx is done, unless not blocking
+func (s slots) reserve(ctx context.Context, block bool) error {
+	if !block {
+		select {
+		case s.free <- struct{}{}:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case s.free <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "err reserve")
+	}
+}
+
+// force reserves a slot even if full, reporting false if reserved beyond the size
+func (s slots) force() bool {
+	select {
+	case s.free <- struct{}{}:
+		return true
+	default:
+		atomic.AddInt64(s.over, 1)
+		return false
+	}
+}
+
+func (s slots) release() {
+	for {
+		over := atomic.LoadInt64(s.over)
+		if over == 0 {
+			break
+		}
+		if atomic.CompareAndSwapInt64(s.over, over, over-1) {
+			return
+		}
+	}
+
+	select {
+	case <-s.free:
+	default:
+	}
+}
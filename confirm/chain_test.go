@@ -0,0 +1,275 @@
+package confirm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+	"github.com/tak1827/transaction-confirmer/confirm/confirmtest"
+)
+
+var genesis = time.Unix(1700000000, 0)
+
+// events receives the published events without blocking
+func events(sub *confirm.Subscription) []string {
+	var got []string
+	for {
+		select {
+		case ev := <-sub.Events():
+			got = append(got, ev.Type.String()+" "+ev.Hash)
+		default:
+			return got
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock),
+		confirm.WithConfirmationIntervalDuration(time.Second),
+		confirm.WithResendWindowDuration(2*time.Second),
+		confirm.WithRetryBackoffDuration(time.Second),
+		confirm.WithMaxRetryBackoffDuration(time.Second))
+	sub := c.Subscribe(confirm.FilterTypes(confirm.EventConfirmed, confirm.EventFailed, confirm.EventResent))
+
+	for _, tx := range []string{"0x01", "0x02", "0x03"} {
+		err := c.EnqueueTx(ctx, tx)
+		require.NoError(t, err)
+	}
+	chain.Fail("0x02")
+	require.True(t, chain.Drop("0x03"))
+	chain.SetErrorRate(0.2, nil)
+
+	for i := 0; i < 30 && c.QueueLen() > 0; i++ {
+		chain.Mine(1)
+		clock.Advance(time.Second)
+		c.DequeueTxs(ctx)
+	}
+	require.Equal(t, 0, c.QueueLen())
+
+	require.ElementsMatch(t, []string{
+		"confirmed 0x01",
+		"failed 0x02",
+		"resent 0x03",
+		"confirmed 0x03",
+	}, events(sub))
+	require.Equal(t, 2, chain.Sends("0x03"))
+
+	_, err := c.DeadLetter("0x02")
+	require.NoError(t, err)
+}
+
+func TestChainReorg(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock),
+		confirm.WithConfirmationIntervalDuration(time.Second),
+		confirm.WithReorgWatchWindowDuration(time.Minute))
+	sub := c.Subscribe(nil)
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(3)
+
+	clock.Advance(time.Second)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	// mined again in another block
+	chain.Reorg(3)
+	clock.Advance(time.Second)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	clock.Advance(time.Second)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"sent 0x01",
+		"confirmed 0x01",
+		"reorged 0x01",
+		"confirmed 0x01",
+	}, events(sub))
+
+	// removed after the watch window
+	clock.Advance(time.Minute)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, c.QueueLen())
+}
+
+func TestExpire(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chain   = confirmtest.NewChain()
+		clock   = confirmtest.NewClock(genesis)
+		s       = confirm.NewMemoryStore()
+		expired = make(chan time.Duration, 1)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithStore(s),
+		confirm.WithConfirmationInterval(0), confirm.WithResendWindow(0), confirm.WithMaxAge(1),
+		confirm.WithAfterTxExpired(func(h string, age time.Duration) error {
+			expired <- age
+			return nil
+		}))
+
+	// never mined
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Drop("0x01")
+
+	clock.Advance(999 * time.Millisecond)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	clock.Advance(time.Millisecond)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Equal(t, time.Second, <-expired)
+
+	require.Equal(t, 0, s.Len())
+	require.Equal(t, 0, c.QueueLen())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithRetryBackoff(60))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(3)
+
+	chain.SetErrorRate(1, errors.New("503 Service Unavailable"))
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	chain.SetErrorRate(0, nil)
+
+	// backed off until the retry, half of the backoff at least with jitter
+	clock.Advance(29 * time.Second)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	st, _ := c.Status("0x01")
+	require.Equal(t, 1, st.Attempts)
+
+	clock.Advance(31 * time.Second)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	st, _ = c.Status("0x01")
+	require.Equal(t, 2, st.Attempts)
+	require.Equal(t, confirm.TxConfirmed, st.State)
+}
+
+func TestClock(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chain     = confirmtest.NewChain()
+		clock     = confirmtest.NewClock(genesis)
+		confirmed = make(chan time.Duration, 1)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationIntervalDuration(time.Minute),
+		confirm.WithWorkerIntervalDuration(time.Millisecond),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed <- ev.Latency
+			return nil
+		}))
+
+	err := c.Start(ctx)
+	require.NoError(t, err)
+	defer c.Shutdown(ctx)
+
+	err = c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+
+	// the worker sleeps until the entry gets due
+	clock.Advance(time.Millisecond)
+	clock.BlockUntil(1)
+	st, _ := c.Status("0x01")
+	require.Equal(t, 0, st.Attempts)
+
+	// pending until mined
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	st, _ = c.Status("0x01")
+	require.Equal(t, 1, st.Attempts)
+
+	// rechecked after the interval
+	chain.Mine(3)
+	clock.Advance(time.Millisecond)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	require.Equal(t, 2*time.Minute+2*time.Millisecond, <-confirmed)
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	const blockTime = 12 * time.Second
+
+	run := func(adaptive bool) (confirm.TxStatus, time.Duration, time.Duration) {
+		var (
+			ctx       = context.Background()
+			chain     = confirmtest.NewChain()
+			clock     = confirmtest.NewClock(genesis)
+			confirmed = make(chan time.Duration, 1)
+		)
+
+		c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock),
+			confirm.WithConfirmationBlock(10),
+			confirm.WithConfirmationIntervalDuration(time.Second),
+			confirm.WithAdaptiveInterval(adaptive),
+			confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+				confirmed <- ev.Latency
+				return nil
+			}))
+
+		err := c.EnqueueTx(ctx, "0x01")
+		require.NoError(t, err)
+
+		for i := 1; i <= 200 && c.QueueLen() > 0; i++ {
+			clock.Advance(time.Second)
+			if time.Duration(i)*time.Second%blockTime == 0 {
+				chain.Mine(1)
+			}
+			_, err = c.DequeueTx(ctx)
+			require.NoError(t, err)
+		}
+
+		st, _ := c.Status("0x01")
+		return st, <-confirmed, c.BlockTime()
+	}
+
+	// polled every interval
+	st, latency, learned := run(false)
+	require.Equal(t, confirm.TxConfirmed, st.State)
+	require.Equal(t, 132, st.Attempts)
+	require.Equal(t, 11*blockTime, latency)
+	require.Equal(t, blockTime, learned)
+
+	// rechecked when the 10th block on top of the including one is expected
+	st, latency, learned = run(true)
+	require.Equal(t, confirm.TxConfirmed, st.State)
+	require.Equal(t, 25, st.Attempts)
+	require.Equal(t, 11*blockTime, latency)
+	require.Equal(t, blockTime, learned)
+}
@@ -0,0 +1,93 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// ErrClass tells how to handle an error returned by the client
+type ErrClass int
+
+const (
+	ErrClassUnknown   ErrClass = iota // reported to ErrHandler, and retried
+	ErrClassTransient                 // retried with backoff silently
+	ErrClassPermanent                 // given up, and passed to AfterTxFailed
+)
+
+func (c ErrClass) String() string {
+	switch c {
+	case ErrClassTransient:
+		return "transient"
+	case ErrClassPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+// Classifier classifies errors returned by ConfirmTx
+type Classifier func(err error) ErrClass
+
+// transientMessages are found in errors of RPC nodes and HTTP gateways.
+// Status codes are matched only with the reason phrase or by transientStatus,
+// not to match hashes in messages.
+var transientMessages = []string{
+	"too many requests",
+	"rate limit",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+	"connection refused",
+	"connection reset",
+}
+
+// transientStatus matches the status code told as such, e.g. "status code: 503"
+var transientStatus = regexp.MustCompile(`\b(?:status|code)\W*(?:429|5\d\d)\b`)
+
+// DefaultClassifier treats ErrTxFailed as permanent,
+// and timeouts, connection errors, 5xx and rate limits as transient
+func DefaultClassifier(err error) ErrClass {
+	if errors.Is(err, ErrTxFailed) {
+		return ErrClassPermanent
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return ErrClassTransient
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ErrClassTransient
+	}
+
+	// e.g. http errors of custom clients
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		if code := sc.StatusCode(); code == 429 || code >= 500 {
+			return ErrClassTransient
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return ErrClassTransient
+		}
+	}
+	if transientStatus.MatchString(msg) {
+		return ErrClassTransient
+	}
+
+	return ErrClassUnknown
+}
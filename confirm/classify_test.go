@@ -0,0 +1,45 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type statusErr int
+
+func (e statusErr) Error() string {
+	return fmt.Sprintf("status %d", int(e))
+}
+
+func (e statusErr) StatusCode() int {
+	return int(e)
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrClass
+	}{
+		{fmt.Errorf("wrapped: %w", ErrTxFailed), ErrClassPermanent},
+		{context.DeadlineExceeded, ErrClassTransient},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), ErrClassTransient},
+		{errors.New("429 Too Many Requests"), ErrClassTransient},
+		{errors.New("502 Bad Gateway: "), ErrClassTransient},
+		{statusErr(503), ErrClassTransient},
+		{statusErr(400), ErrClassUnknown},
+		{errors.New("503 Service Unavailable"), ErrClassTransient},
+		{errors.New("unexpected status code: 504"), ErrClassTransient},
+		{errors.New("invalid argument"), ErrClassUnknown},
+		{errors.New("no result of ConfirmTxs, hash: 0x3f503a429c502d504e"), ErrClassUnknown},
+		{errors.New("nonce 503 too low"), ErrClassUnknown},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.want, DefaultClassifier(tt.err), tt.err.Error())
+	}
+}
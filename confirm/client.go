@@ -10,3 +10,36 @@ type Client interface {
 	// Nonce(ctx context.Context, privKey string) (nonce uint64, err error)
 	// LatestBlockNumber(ctx context.Context) (uint64, error)
 }
+
+// Replacer is optionally implemented by Client to replace a stuck tx.
+// ReplaceTx returns a tx signed with the same nonce and bumped fee,
+// which is sent by SendTx afterward.
+type Replacer interface {
+	ReplaceTx(ctx context.Context, tx interface{}) (interface{}, error)
+}
+
+// BlockReporter is optionally implemented by Client to detect reorgs.
+// TxBlock returns the number and the hash of the canonical block including the tx,
+// or ErrTxNotFound if not included.
+type BlockReporter interface {
+	TxBlock(ctx context.Context, hash string) (uint64, string, error)
+}
+
+// HeadSubscriber is optionally implemented by Client to drive confirmation by new blocks.
+// SubscribeHeads sends the number of each new head, and closes the channel
+// when the subscription ends.
+type HeadSubscriber interface {
+	SubscribeHeads(ctx context.Context) (<-chan uint64, error)
+}
+
+// BatchClient is optionally implemented by Client to confirm multiple txs at once.
+// ConfirmTxs returns the result of each hash, the same as ConfirmTx.
+type BatchClient interface {
+	ConfirmTxs(ctx context.Context, hashes []string, confirmationBlocks uint64) map[string]error
+}
+
+// ReceiptReporter is optionally implemented by Client to enrich the confirmed event.
+// TxReceipt returns the receipt of the mined tx.
+type ReceiptReporter interface {
+	TxReceipt(ctx context.Context, hash string) (Receipt, error)
+}
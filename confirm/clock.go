@@ -0,0 +1,25 @@
+package confirm
+
+import "time"
+
+// Clock reads the time and creates timers for the confirmer.
+// Replaced by a fake one to control the time in tests, see confirmtest.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns the channel receiving the time after the duration,
+	// and the func stopping it, which reports whether stopped before firing
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+var _ Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
@@ -2,44 +2,82 @@ package confirm
 
 import (
 	"context"
-	"fmt"
+	"math/rand"
+	"sort"
 	"sync/atomic"
 	"time"
 
-	"github.com/lithdew/bytesutil"
 	"github.com/pkg/errors"
-	"github.com/tak1827/go-queue/queue"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type (
-	HashHandler func(string) error
-	ErrHandler  func(string, error)
+	HashHandler    func(string) error
+	ExpireHandler  func(string, time.Duration) error
+	ResendHandler  func(string, int) error
+	ReplaceHandler func(string, string) error
+	FailHandler    func(string, error) error
+	ErrHandler     func(string, error)
 )
 
 type Confirmer struct {
-	client Client
-	queue  *queue.Queue
+	client   Client
+	batch    BatchClient // nil unless the client implements
+	queue    *schedule
+	store    Store
+	parked   Store // dead letters, kept in memory unless set
+	txs      *txMap
+	statuses *statuses
+	index    *index
+	slots    slots
+	logger   Logger
+	subs     *subscriptions
+	metrics  Metrics
+	tracer   trace.Tracer
+	clock    Clock
+	blocks   *blockTime
 
 	confirmationBlocks   uint64
-	confirmationInterval int64 // sec
+	confirmationInterval time.Duration
 	workers              int
-	workerInterval       int64 // milisec
-	timeout              int64 // sec
+	workerInterval       time.Duration
+	timeout              time.Duration
+	resendWindow         time.Duration
+	maxResends           int
+	replaceAfter         time.Duration
+	maxReplacements      int
+	reorgWatchWindow     time.Duration
+	maxAge               time.Duration
+	headDriven           bool
+	adaptiveInterval     bool
+	batchSize            int
+	drainOnShutdown      bool
+	retryBackoff         time.Duration
+	maxRetries           int
+	maxHandlerAttempts   int
+	duplicate            Duplicate
+	blockingEnqueue      bool
+	maxRetryBackoff      time.Duration
+	classify             Classifier
 
-	AfterTxSent      HashHandler
-	AfterTxConfirmed HashHandler
-	ErrHandler       ErrHandler
+	AfterTxSent      EventHandler
+	AfterTxConfirmed EventHandler
+	AfterTxResent    ResendHandler
+	AfterTxReplaced  ReplaceHandler
+	AfterTxReorged   HashHandler
+	AfterTxExpired   ExpireHandler
+	AfterTxFailed    FailHandler
+	ErrHandler       ErrEventHandler
 
-	closeCounter uint32
-}
-
-type entry struct {
-	hash      string
-	updatedAt int64
+	lifecycle *lifecycle
+	head      uint64 // latest head subscribed, zero if not subscribing
 }
 
 func NewConfirmer(client Client, queueSize int, opts ...Opt) Confirmer {
-	q := queue.NewQueue(queueSize, false)
+	if queueSize == 0 {
+		queueSize = DEFAULT_QUEUE_SIZE
+	}
 
 	if DEFAULT_WORKERS == 0 {
 		DEFAULT_WORKERS = 1
@@ -47,150 +85,1033 @@ func NewConfirmer(client Client, queueSize int, opts ...Opt) Confirmer {
 
 	c := Confirmer{
 		client:               client,
-		queue:                &q,
+		queue:                newSchedule(),
+		store:                nopStore{},
+		parked:               NewMemoryStore(),
+		txs:                  newTxMap(),
+		statuses:             newStatuses(DEFAULT_STATUS_HISTORY),
+		index:                newIndex(),
+		slots:                newSlots(queueSize),
+		logger:               nopLogger{},
+		subs:                 newSubscriptions(),
+		metrics:              nopMetrics{},
+		tracer:               noop.NewTracerProvider().Tracer(TracerName),
+		clock:                systemClock{},
+		blocks:               &blockTime{},
 		confirmationBlocks:   DEFAULT_CONFIEMATION_BLOCKS,
-		confirmationInterval: DEFAULT_CONFIEMATION_INTERVAL,
+		confirmationInterval: time.Duration(DEFAULT_CONFIEMATION_INTERVAL) * time.Second,
 		workers:              DEFAULT_WORKERS,
-		workerInterval:       DEFAULT_WORKER_INTERVAL,
-		timeout:              DEFAULT_TIMEOUT,
-		AfterTxSent:          DefaultAfterTxSent,
-		AfterTxConfirmed:     DefaultAfterTxConfirmed,
-		ErrHandler:           DefaultErrHandler,
-		closeCounter:         0,
+		workerInterval:       time.Duration(DEFAULT_WORKER_INTERVAL) * time.Millisecond,
+		timeout:              time.Duration(DEFAULT_TIMEOUT) * time.Second,
+		resendWindow:         time.Duration(DEFAULT_RESEND_WINDOW) * time.Second,
+		maxResends:           DEFAULT_MAX_RESENDS,
+		replaceAfter:         time.Duration(DEFAULT_REPLACE_AFTER) * time.Second,
+		maxReplacements:      DEFAULT_MAX_REPLACEMENTS,
+		reorgWatchWindow:     time.Duration(DEFAULT_REORG_WATCH_WINDOW) * time.Second,
+		maxAge:               time.Duration(DEFAULT_MAX_AGE) * time.Second,
+		batchSize:            DEFAULT_BATCH_SIZE,
+		retryBackoff:         time.Duration(DEFAULT_RETRY_BACKOFF) * time.Second,
+		maxRetryBackoff:      time.Duration(DEFAULT_MAX_RETRY_BACKOFF) * time.Second,
+		maxRetries:           DEFAULT_MAX_RETRIES,
+		maxHandlerAttempts:   DEFAULT_MAX_HANDLER_ATTEMPTS,
+		classify:             DefaultClassifier,
+		AfterTxSent:          HashEventHandler(DefaultAfterTxSent),
+		AfterTxConfirmed:     HashEventHandler(DefaultAfterTxConfirmed),
+		AfterTxResent:        DefaultAfterTxResent,
+		AfterTxReplaced:      DefaultAfterTxReplaced,
+		AfterTxReorged:       DefaultAfterTxReorged,
+		AfterTxExpired:       DefaultAfterTxExpired,
+		AfterTxFailed:        DefaultAfterTxFailed,
+		ErrHandler:           ErrHashEventHandler(DefaultErrHandler),
+		lifecycle:            &lifecycle{},
 	}
 
 	for i := range opts {
 		opts[i].Apply(&c)
 	}
 
+	if b, ok := client.(BatchClient); ok {
+		c.batch = b
+	}
+
 	return c
 }
 
-func (c *Confirmer) EnqueueTx(ctx context.Context, tx interface{}) error {
-	hash, err := c.client.SendTx(ctx, tx)
+// EnqueueTx sends the tx and tracks it. The queue capacity is reserved before sending,
+// waiting for a free one until the ctx is done in the blocking enqueue mode,
+// otherwise ErrQueueFull is returned. The sent tx is tracked even if AfterTxSent fails.
+func (c *Confirmer) EnqueueTx(ctx context.Context, tx interface{}, opts ...TxOpt) error {
+	return c.enqueueTx(ctx, tx, c.blockingEnqueue, opts)
+}
+
+// TryEnqueue is EnqueueTx never waiting for the capacity
+func (c *Confirmer) TryEnqueue(ctx context.Context, tx interface{}, opts ...TxOpt) error {
+	return c.enqueueTx(ctx, tx, false, opts)
+}
+
+func (c *Confirmer) enqueueTx(ctx context.Context, tx interface{}, block bool, opts []TxOpt) (err error) {
+	ctx, span := c.tracer.Start(ctx, SpanEnqueueTx)
+	defer func() { endSpan(span, err) }()
+
+	// rejected before sent, not to leave a sent tx untracked
+	if err = newEntry("", 0, opts...).validate(); err != nil {
+		return err
+	}
+
+	// not to leave a sent tx untracked
+	if err = c.slots.reserve(ctx, block); err != nil {
+		return err
+	}
+
+	sctx, sspan := c.tracer.Start(ctx, SpanSendTx)
+	hash, err := c.client.SendTx(sctx, tx)
+	endSpan(sspan, err)
 	if err != nil {
+		c.slots.release()
 		return errors.Wrap(err, "err SendTx")
 	}
 
-	if err = c.AfterTxSent(hash); err != nil {
+	c.metrics.TxSent()
+	span.SetAttributes(AttrHash.String(hash))
+
+	ent := newEntry(hash, c.now(), opts...)
+	ent.spanContext = span.SpanContext()
+	// built ahead, as the entry is left to workers once queued
+	ev := c.event(EventSent, ent, hash, ent.enqueuedAt)
+	ev.Tx = tx
+
+	// tracked regardless of the handler, as broadcast already
+	if err = c.admit(ent, tx, TxSent, opts); err != nil {
+		if err == errMerged {
+			return nil
+		}
+		return err
+	}
+	c.logger.Debug("tx enqueued", LogKeyHash, hash)
+
+	c.publish(ctx, ev)
+	if err = c.AfterTxSent(ctx, ev); err != nil {
+		c.metrics.HandlerError()
 		return errors.Wrap(err, "err afterTxSent")
 	}
 
-	e := &queue.Entry{
-		Key:   hash,
-		Value: bytesutil.AppendUint64LE([]byte{}, uint64(time.Now().Unix())),
+	return nil
+}
+
+// EnqueueTxHash tracks the hash sent elsewhere, reserving the capacity as EnqueueTx
+func (c *Confirmer) EnqueueTxHash(ctx context.Context, hash string, opts ...TxOpt) (err error) {
+	_, span := c.tracer.Start(ctx, SpanEnqueueTxHash, trace.WithAttributes(AttrHash.String(hash)))
+	defer func() { endSpan(span, err) }()
+
+	ent := newEntry(hash, c.now(), opts...)
+	ent.spanContext = span.SpanContext()
+	if err = ent.validate(); err != nil {
+		return err
 	}
 
-	if err = c.queue.Enqueue(e); err != nil {
-		return errors.Wrap(err, "err Enqueue")
+	if err = c.slots.reserve(ctx, c.blockingEnqueue); err != nil {
+		return err
 	}
+	if err = c.admit(ent, nil, TxQueued, opts); err != nil {
+		if err == errMerged {
+			return nil
+		}
+		return err
+	}
+	c.logger.Debug("tx hash enqueued", LogKeyHash, hash)
 
 	return nil
 }
 
-func (c *Confirmer) EnqueueTxHash(ctx context.Context, hash string) error {
-	e := &queue.Entry{
-		Key:   hash,
-		Value: bytesutil.AppendUint64LE([]byte{}, uint64(time.Now().Unix())),
+// admit tracks the entry on the slot reserved, writing it ahead to the store and queueing it.
+// The slot is released unless admitted, returning errMerged if merged into the tracked one.
+// The tx is retained for resending, nil if sent elsewhere.
+func (c *Confirmer) admit(e *entry, tx interface{}, state TxState, opts []TxOpt) error {
+	if err := c.track(e, opts); err != nil {
+		if err == errMerged && tx != nil {
+			c.txs.set(e.hash, tx)
+		}
+		c.slots.release()
+		return err
 	}
 
-	if err := c.queue.Enqueue(e); err != nil {
-		return errors.Wrap(err, "err Enqueue")
+	// write ahead, so that the hash is resumed after crash
+	// even if the process dies right after notifying it
+	if err := c.store.Put(e.hash, e.encode()); err != nil {
+		c.index.remove(e)
+		c.slots.release()
+		return errors.Wrap(err, "err Put")
 	}
 
+	if tx != nil {
+		c.txs.set(e.hash, tx)
+	}
+	// recorded once nothing fails, before queued not to overwrite the checks by workers
+	c.statuses.enqueued(e, state)
+	c.queue.push(e, c.nextCheck(e))
+	return nil
+}
+
+// track indexes the new entry. The duplicate is rejected,
+// or merged into the tracked one returning errMerged.
+func (c *Confirmer) track(e *entry, opts []TxOpt) error {
+	if _, ok := c.index.track(e); ok {
+		return nil
+	}
+
+	if c.duplicate == DuplicateMerge && c.index.merge(e.hash, opts) {
+		c.logger.Debug("tx merged", LogKeyHash, e.hash)
+		return errMerged
+	}
+	return ErrAlreadyTracked
+}
+
+// untrack stops tracking the finished entry, recording the state and deleting it from the store.
+// Nothing is touched if removed or tracked again meanwhile, reported by false,
+// not to finish the new one by the stale entry.
+func (c *Confirmer) untrack(e *entry, state TxState, err error) (bool, error) {
+	defer c.slots.release()
+
+	err = c.index.removeIf(e, func() error {
+		c.txs.delete(e.hash)
+		c.statuses.finish(e, state, err)
+		if derr := c.store.Delete(e.hash); derr != nil {
+			return errors.Wrap(derr, "err Delete")
+		}
+		return c.deleteStale(e)
+	})
+	if err == ErrNotTracked {
+		return false, nil
+	}
+	return true, err
+}
+
+// stale reports whether the entry is removed or tracked again during the check,
+// dropping it not to touch the tracked one
+func (c *Confirmer) stale(e *entry) bool {
+	if c.index.tracks(e) {
+		return false
+	}
+	c.slots.release()
+	return true
+}
+
+// Contains reports whether the hash is tracked, including the replaced ones
+func (c *Confirmer) Contains(hash string) bool {
+	return c.index.has(hash)
+}
+
+// Remove stops tracking the tx, ErrNotTracked unless tracked.
+// The one being checked by a worker is dropped after the check,
+// which may still notify the handlers.
+func (c *Confirmer) Remove(hash string) error {
+	// deleted before enqueued again, not to delete the new one
+	err := c.index.removeHash(hash, func(key string) error {
+		// the one being checked is dropped by the worker
+		if c.queue.remove(key) {
+			c.slots.release()
+		}
+		c.txs.delete(key)
+		c.statuses.remove(key)
+		if err := c.store.Delete(key); err != nil {
+			return errors.Wrap(err, "err Delete")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("tx removed", LogKeyHash, hash)
 	return nil
 }
 
 func (c *Confirmer) DequeueTx(ctx context.Context) (string, error) {
-	e, isEmpty := c.queue.Dequeue()
-	if isEmpty {
-		return "", nil
+	var (
+		now  = c.now()
+		head = atomic.LoadUint64(&c.head)
+	)
+
+	e, hash, err := c.dequeue(now, head)
+	if e == nil {
+		return hash, err
 	}
 
+	ctx, span := c.startRecheck(ctx, e)
+	mined, hash, err := c.check(ctx, e, now, head)
+	span.SetAttributes(AttrMined.String(mined))
+	endSpan(span, err)
+
+	return hash, err
+}
+
+// DequeueTxs confirms up to the batch size of due entries at once by BatchClient,
+// or one by one unless the client is BatchClient. Errors are returned by the hash.
+func (c *Confirmer) DequeueTxs(ctx context.Context) map[string]error {
 	var (
-		hash      = e.Key
-		updatedAt = int64(bytesutil.Uint64LE(e.Value))
-		now       = time.Now().Unix()
+		now     = c.now()
+		head    = atomic.LoadUint64(&c.head)
+		entries = make([]*entry, 0, c.batchSize)
+		errs    = make(map[string]error)
 	)
 
-	if now < updatedAt+c.confirmationInterval {
-		if err := c.queue.Enqueue(e); err != nil {
-			return hash, errors.Wrap(err, "err Enqueue")
+	// stops once nothing is due, bounded not to loop over the rescheduled entries
+	for n := c.queue.Len(); n > 0 && len(entries) < c.batchSize && c.queue.due(now); n-- {
+		e, hash, err := c.dequeue(now, head)
+		if err != nil {
+			errs[hash] = err
+		}
+		if e != nil {
+			entries = append(entries, e)
 		}
-		return hash, nil
 	}
 
-	if err := c.client.ConfirmTx(ctx, hash, c.confirmationBlocks); err != nil {
-		if errors.Is(err, ErrTxNotFound) || errors.Is(err, ErrTxConfirmPending) {
-			e.Value = bytesutil.AppendUint64LE([]byte{}, uint64(now))
-			if err = c.queue.Enqueue(e); err != nil {
-				return hash, errors.Wrap(err, "err Enqueue")
-			}
-			return hash, nil
+	if len(entries) == 0 {
+		return errs
+	}
+
+	var (
+		ctxs      = make([]context.Context, len(entries))
+		spans     = make([]trace.Span, len(entries))
+		links     = make([]trace.Link, 0, len(entries))
+		confirmed = make([]*entry, 0, len(entries))
+	)
+	for i, e := range entries {
+		ctxs[i], spans[i] = c.startRecheck(ctx, e)
+		// confirmed already, only the handler is retried
+		if e.minedHash != "" {
+			continue
 		}
+		links = append(links, trace.Link{SpanContext: spans[i].SpanContext()})
+		confirmed = append(confirmed, e)
+	}
 
-		return hash, errors.Wrap(err, "err ConfirmTx")
+	// the batch is shared by traces, so linked to each recheck
+	var results map[*entry]confirmResult
+	if len(confirmed) > 0 {
+		bctx, bspan := c.tracer.Start(ctx, SpanConfirmTxs, trace.WithLinks(links...))
+		results = c.confirmBatch(bctx, confirmed)
+		bspan.End()
 	}
 
-	if err := c.AfterTxConfirmed(hash); err != nil {
-		return hash, errors.Wrap(err, "err afterTxSent")
+	for i, e := range entries {
+		var (
+			mined, hash string
+			err         error
+		)
+		if e.minedHash != "" {
+			mined = e.minedHash
+			hash, err = c.notifyConfirmed(ctxs[i], e, now, head, mined)
+		} else {
+			r := results[e]
+			mined = r.mined
+			hash, err = c.settle(ctxs[i], e, now, head, r.mined, r.err)
+		}
+		spans[i].SetAttributes(AttrMined.String(mined))
+		endSpan(spans[i], err)
+		if err != nil {
+			errs[hash] = err
+		}
 	}
 
-	return hash, nil
+	return errs
 }
 
-func (c *Confirmer) QueueLen() int {
-	return c.queue.Len()
+// dequeue pops the earliest entry due by now. The one waiting for a new head
+// is held until the head moves, otherwise rescheduled by its next check.
+func (c *Confirmer) dequeue(now int64, head uint64) (*entry, string, error) {
+	e, ok := c.queue.pop(now)
+	if !ok {
+		return nil, "", nil
+	}
+	hash := e.hash
+
+	// removed, or tracked again by another entry
+	if !c.index.current(e) {
+		c.slots.release()
+		return nil, hash, nil
+	}
+
+	if !c.due(e, now, head) {
+		if head > 0 && now >= e.retryAt && e.minedHash == "" {
+			c.queue.hold(e, head, now)
+		} else {
+			c.queue.push(e, c.nextCheck(e))
+		}
+		return nil, hash, nil
+	}
+
+	return e, hash, nil
 }
 
-func (c *Confirmer) Start(ctx context.Context) error {
+// settle moves the entry forward by the result of confirming
+func (c *Confirmer) settle(ctx context.Context, e *entry, now int64, head uint64, mined string, err error) (string, error) {
+	if c.stale(e) {
+		return mined, nil
+	}
+
+	hash := e.hash
+	e.checkedHead = head
+
+	// checked without an error, backoff is reset
+	if err == nil || errors.Is(err, ErrTxNotFound) || errors.Is(err, ErrTxConfirmPending) {
+		e.retries, e.retryAt = 0, 0
+	}
+
+	c.progress(e, now, err)
+	reorged, rerr := c.detectReorg(ctx, e, mined, err)
+	c.statuses.checked(e, now, err)
+	c.logger.Debug("tx rechecked", LogKeyHash, mined, LogKeyAttempt, e.attempts, LogKeyErr, err)
+	if rerr != nil {
+		if err = c.requeue(e, now); err != nil {
+			return mined, err
+		}
+		return mined, rerr
+	}
+	if reorged {
+		// back to pending, so that confirmed again on the new chain
+		e.confirmedAt = 0
+		e.notFoundAt = 0
+		c.statuses.reorged(e)
+		c.logger.Info("tx reorged", LogKeyHash, mined, LogKeyBlock, e.blockNumber)
+		ev := c.event(EventReorged, e, mined, now)
+		// notified even if failed to persist, as requeued anyway
+		qerr := c.requeue(e, now)
+		c.publish(ctx, ev)
+		if err = c.AfterTxReorged(mined); err != nil {
+			c.metrics.HandlerError()
+			return mined, errors.Wrap(err, "err afterTxReorged")
+		}
+		return mined, qerr
+	}
 
-	worker := func(cancelCtx context.Context, c *Confirmer, id int) {
-		timer := time.NewTicker(time.Duration(c.workerInterval) * time.Millisecond)
-		defer timer.Stop()
+	// already confirmed, watching for late reorgs
+	if e.confirmedAt > 0 {
+		if now < e.confirmedAt+int64(c.reorgWatchWindow) {
+			return mined, c.requeue(e, now)
+		}
+		_, err = c.untrack(e, TxConfirmed, nil)
+		return mined, err
+	}
+
+	if (errors.Is(err, ErrTxNotFound) || errors.Is(err, ErrTxConfirmPending)) && c.expired(e, now) {
+		return mined, c.expire(ctx, e, now, mined)
+	}
 
-		for {
-			select {
-			case <-cancelCtx.Done():
-				fmt.Printf("worker(%d) is closing\n", id)
-				atomic.AddUint32(&c.closeCounter, 1)
-				return
-			case <-timer.C:
-				ctx, cancel := c.withTimeout()
-				defer cancel()
+	if err != nil {
+		if errors.Is(err, ErrTxNotFound) {
+			c.metrics.TxNotFound()
+
+			// keep tracking even if failed to replace or resend
+			replacedHash, rerr := c.replace(ctx, e, now)
+			if replacedHash == "" && rerr == nil {
+				rerr = c.resend(ctx, e, now)
+			}
+			if replacedHash != "" {
+				e.staleKeys = append(e.staleKeys, replacedHash)
+			}
+			newHash := e.hash
+			if err = c.requeue(e, now); err != nil {
+				return hash, err
+			}
+			return newHash, rerr
+		}
+
+		if errors.Is(err, ErrTxConfirmPending) {
+			c.metrics.TxPending()
+			e.notFoundAt = 0
+			return hash, c.requeue(e, now)
+		}
+
+		return c.fail(ctx, e, now, mined, err)
+	}
+
+	// notify the mined one, which may be a replaced hash
+	return c.notifyConfirmed(ctx, e, now, head, mined)
+}
+
+// notifyConfirmed delivers the confirmed tx to AfterTxConfirmed at least once.
+// Failed one is retried with backoff without rechecking the tx,
+// and parked as a dead letter after the max handler attempts.
+func (c *Confirmer) notifyConfirmed(ctx context.Context, e *entry, now int64, head uint64, mined string) (string, error) {
+	if c.stale(e) {
+		return mined, nil
+	}
+
+	ev := c.confirmedEvent(ctx, e, mined, now, head)
+	// retried ones are notified to the handler only
+	if e.minedHash == "" {
+		latency := time.Duration(now - e.enqueuedAt)
+		c.logger.Info("tx confirmed", LogKeyHash, mined, LogKeyAttempt, e.attempts, LogKeyLatency, latency)
+		c.metrics.TxConfirmed(latency)
+		c.publish(ctx, ev)
+	}
+
+	_, hspan := c.tracer.Start(ctx, SpanAfterTxConfirmed, trace.WithAttributes(AttrHash.String(mined)))
+	err := c.AfterTxConfirmed(ctx, ev)
+	endSpan(hspan, err)
+	if err != nil {
+		c.metrics.HandlerError()
+		e.handlerAttempts++
+		err = errors.Wrap(err, "err afterTxConfirmed")
 
-				if hash, err := c.DequeueTx(ctx); err != nil {
-					c.ErrHandler(hash, err)
+		if c.maxHandlerAttempts > 0 && int(e.handlerAttempts) >= c.maxHandlerAttempts {
+			err = errors.Wrapf(err, "handler attempts exhausted, attempts: %d", c.maxHandlerAttempts)
+			if perr := c.park(e, now, err); perr != nil {
+				// given up next time, not to be lost
+				if rerr := c.requeue(e, now); rerr != nil {
+					return mined, rerr
 				}
+				return mined, errors.Wrap(perr, "err park")
+			}
+			if _, derr := c.untrack(e, TxConfirmed, err); derr != nil {
+				return mined, derr
+			}
+			return mined, err
+		}
+
+		e.minedHash = mined
+		e.retryAt = now + int64(c.backoff(e.handlerAttempts))
+		c.statuses.handlerPending(e, err)
+		if rerr := c.requeue(e, now); rerr != nil {
+			return mined, rerr
+		}
+		return mined, err
+	}
+	e.minedHash, e.handlerAttempts, e.retryAt = "", 0, 0
+
+	if c.watchesReorg() {
+		e.confirmedAt = now
+		c.statuses.checked(e, now, nil)
+		return mined, c.requeue(e, now)
+	}
+
+	_, err = c.untrack(e, TxConfirmed, nil)
+	return mined, err
+}
+
+// check confirms the entry and settles it. Entries confirmed already
+// only retry the handler.
+func (c *Confirmer) check(ctx context.Context, e *entry, now int64, head uint64) (string, string, error) {
+	if e.minedHash != "" {
+		mined := e.minedHash
+		hash, err := c.notifyConfirmed(ctx, e, now, head, mined)
+		return mined, hash, err
+	}
+
+	mined, err := c.confirm(ctx, e)
+	hash, err := c.settle(ctx, e, now, head, mined, err)
+	return mined, hash, err
+}
+
+// fail handles the error of ConfirmTx by the class.
+// Failed tx never be confirmed, others are retried with backoff not to be dropped
+// until exhausting the max retries. Given up ones are parked as dead letters.
+func (c *Confirmer) fail(ctx context.Context, e *entry, now int64, mined string, err error) (string, error) {
+	class := c.classify(err)
+
+	// never retried beyond the deadline or the max age
+	if class != ErrClassPermanent && c.expired(e, now) {
+		return mined, c.expire(ctx, e, now, mined)
+	}
+
+	if class != ErrClassPermanent {
+		e.retries++
+		if c.maxRetries == 0 || int(e.retries) <= c.maxRetries {
+			e.retryAt = now + int64(c.backoff(e.retries))
+			if rerr := c.requeue(e, now); rerr != nil {
+				return mined, rerr
+			}
+
+			if class == ErrClassTransient {
+				c.logger.Info("tx retrying", LogKeyHash, mined, LogKeyAttempt, e.retries, LogKeyErr, err)
+				return mined, nil
+			}
+			return mined, errors.Wrap(err, "err ConfirmTx")
+		}
+		err = errors.Wrapf(err, "retries exhausted, retries: %d", c.maxRetries)
+	}
+
+	// parked before deleted, not to be lost on crash
+	if perr := c.park(e, now, err); perr != nil {
+		// given up next time, not to be lost
+		if rerr := c.requeue(e, now); rerr != nil {
+			return mined, rerr
+		}
+		return mined, errors.Wrap(perr, "err park")
+	}
+
+	ok, derr := c.untrack(e, TxFailed, err)
+	if !ok {
+		return mined, nil
+	}
+	c.metrics.TxFailed()
+	if derr != nil {
+		return mined, derr
+	}
+	c.logger.Info("tx failed", LogKeyHash, mined, LogKeyAttempt, e.attempts, LogKeyErr, err)
+	ev := c.event(EventFailed, e, mined, now)
+	ev.Err = err
+	c.publish(ctx, ev)
+	if herr := c.AfterTxFailed(mined, err); herr != nil {
+		// the default passes the error through
+		if herr != err {
+			c.metrics.HandlerError()
+		}
+		return mined, errors.Wrap(herr, "err afterTxFailed")
+	}
+	return mined, nil
+}
+
+// expire stops tracking the entry passed its deadline or the max age
+func (c *Confirmer) expire(ctx context.Context, e *entry, now int64, mined string) error {
+	if ok, err := c.untrack(e, TxExpired, nil); !ok || err != nil {
+		return err
+	}
+	age := time.Duration(now - e.enqueuedAt)
+	c.logger.Info("tx expired", LogKeyHash, mined, LogKeyAttempt, e.attempts, LogKeyLatency, age)
+	c.publish(ctx, c.event(EventExpired, e, mined, now))
+	if err := c.AfterTxExpired(mined, age); err != nil {
+		c.metrics.HandlerError()
+		return errors.Wrap(err, "err afterTxExpired")
+	}
+	return nil
+}
+
+// backoff returns the delay of the retry,
+// doubled from the retry backoff up to the max with equal jitter
+func (c *Confirmer) backoff(retries uint32) time.Duration {
+	d := c.retryBackoff
+	for i := uint32(1); i < retries && d < c.maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.maxRetryBackoff {
+		d = c.maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return d - half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// progress records the including block reported by PendingError,
+// learning the block time from the head seen
+func (c *Confirmer) progress(e *entry, now int64, err error) {
+	var p *PendingError
+	if errors.As(err, &p) {
+		c.blocks.observe(p.Head(), now)
+		if e.blockHash == "" && p.BlockNumber > 0 {
+			e.blockNumber = p.BlockNumber
+		}
+		return
+	}
+
+	// not mined anymore, the block by BlockReporter is reset on detecting the reorg
+	if errors.Is(err, ErrTxNotFound) && e.blockHash == "" {
+		e.blockNumber = 0
+	}
+}
+
+// detectReorg compares the block including the mined tx with the recorded one.
+// Works only when the client implements BlockReporter.
+func (c *Confirmer) detectReorg(ctx context.Context, e *entry, mined string, confirmErr error) (bool, error) {
+	r, ok := c.client.(BlockReporter)
+	if !ok {
+		return false, nil
+	}
+
+	switch {
+	case errors.Is(confirmErr, ErrTxNotFound):
+		// the including block is reorged out
+		if e.blockHash != "" {
+			e.blockNumber, e.blockHash = 0, ""
+			return true, nil
+		}
+		return false, nil
+	case confirmErr == nil, errors.Is(confirmErr, ErrTxConfirmPending):
+	default:
+		return false, nil
+	}
+
+	number, blockHash, err := r.TxBlock(ctx, mined)
+	if err != nil {
+		if errors.Is(err, ErrTxNotFound) && e.blockHash != "" {
+			e.blockNumber, e.blockHash = 0, ""
+			return true, nil
+		}
+		return false, errors.Wrap(err, "err TxBlock")
+	}
+
+	reorged := e.blockHash != "" && e.blockHash != blockHash
+	e.blockNumber, e.blockHash = number, blockHash
+
+	return reorged, nil
+}
+
+// nextCheck returns when the entry is checked next, by the recheck interval
+// unless following heads, delayed by the retry backoff
+func (c *Confirmer) nextCheck(e *entry) int64 {
+	at := e.updatedAt
+	if e.minedHash == "" && atomic.LoadUint64(&c.head) == 0 {
+		at += int64(c.recheckInterval(e))
+	}
+	if at < e.retryAt {
+		at = e.retryAt
+	}
+	return at
+}
+
+// due reports whether the entry should be checked now.
+// While subscribing heads, checked once per head and only when the depth could be satisfied.
+func (c *Confirmer) due(e *entry, now int64, head uint64) bool {
+	if now < e.retryAt {
+		return false
+	}
+
+	// not waiting for heads, only the handler is retried
+	if e.minedHash != "" {
+		return true
+	}
+
+	if head == 0 {
+		return now >= e.updatedAt+int64(c.recheckInterval(e))
+	}
+
+	if e.checkedHead >= head {
+		return false
+	}
+
+	// the including block is known by BlockReporter
+	if e.blockNumber > 0 && e.blockNumber+c.confirmationBlocksOf(e) > head {
+		return false
+	}
+
+	return true
+}
+
+// recheckInterval returns the confirmation interval. In the adaptive interval,
+// the mined entry waits until the required depth is expected by the block time learned.
+func (c *Confirmer) recheckInterval(e *entry) time.Duration {
+	if !c.adaptiveInterval || e.blockNumber == 0 {
+		return c.confirmationInterval
+	}
+
+	head, avg := c.blocks.estimate()
+	target := e.blockNumber + c.confirmationBlocksOf(e)
+	if avg == 0 || target <= head {
+		return c.confirmationInterval
+	}
+
+	if d := time.Duration(target-head) * avg; d > c.confirmationInterval {
+		return d
+	}
+	return c.confirmationInterval
+}
+
+// BlockTime returns the average block time learned from the heads seen,
+// zero until two different heads are seen
+func (c *Confirmer) BlockTime() time.Duration {
+	_, avg := c.blocks.estimate()
+	return avg
+}
+
+// expired reports whether the entry passed its deadline or the max age
+func (c *Confirmer) expired(e *entry, now int64) bool {
+	if e.deadline > 0 && now >= e.deadline {
+		return true
+	}
+	return c.maxAge > 0 && now >= e.enqueuedAt+int64(c.maxAge)
+}
+
+func (c *Confirmer) confirmationBlocksOf(e *entry) uint64 {
+	if e.confirmationBlocks > 0 {
+		return e.confirmationBlocks
+	}
+	return c.confirmationBlocks
+}
+
+func (c *Confirmer) watchesReorg() bool {
+	_, ok := c.client.(BlockReporter)
+	return ok && c.reorgWatchWindow > 0
+}
+
+// confirm checks every hash sent for the entry, the latest first.
+// The mined hash is returned unless none of them is found.
+func (c *Confirmer) confirm(ctx context.Context, e *entry) (string, error) {
+	e.attempts++
+
+	for _, hash := range e.hashes() {
+		cctx, span := c.tracer.Start(ctx, SpanConfirmTx, trace.WithAttributes(AttrHash.String(hash)))
+		start := c.clock.Now()
+		err := c.client.ConfirmTx(cctx, hash, c.confirmationBlocksOf(e))
+		c.metrics.ConfirmTxDuration(c.clock.Now().Sub(start))
+		endSpan(span, err)
+		if errors.Is(err, ErrTxNotFound) {
+			continue
+		}
+		return hash, err
+	}
+	return e.hash, ErrTxNotFound
+}
+
+type confirmResult struct {
+	mined string
+	err   error
+}
+
+// confirmBatch is confirm for multiple entries, calling ConfirmTxs
+// once for each confirmation blocks, otherwise confirm for each without BatchClient
+func (c *Confirmer) confirmBatch(ctx context.Context, entries []*entry) map[*entry]confirmResult {
+	if c.batch == nil {
+		results := make(map[*entry]confirmResult, len(entries))
+		for _, e := range entries {
+			mined, err := c.confirm(ctx, e)
+			results[e] = confirmResult{mined: mined, err: err}
+		}
+		return results
+	}
+
+	groups := make(map[uint64][]string)
+	for _, e := range entries {
+		e.attempts++
+
+		blocks := c.confirmationBlocksOf(e)
+		groups[blocks] = append(groups[blocks], e.hashes()...)
+	}
+
+	errs := make(map[string]error)
+	for blocks, hashes := range groups {
+		start := c.clock.Now()
+		for hash, err := range c.batch.ConfirmTxs(ctx, hashes, blocks) {
+			errs[hash] = err
+		}
+		c.metrics.ConfirmTxDuration(c.clock.Now().Sub(start))
+	}
+
+	results := make(map[*entry]confirmResult, len(entries))
+	for _, e := range entries {
+		r := confirmResult{mined: e.hash, err: ErrTxNotFound}
+		for _, hash := range e.hashes() {
+			err, ok := errs[hash]
+			if !ok {
+				err = errors.Errorf("no result of ConfirmTxs, hash: %s", hash)
+			}
+			if errors.Is(err, ErrTxNotFound) {
+				continue
 			}
+			r = confirmResult{mined: hash, err: err}
+			break
 		}
+		results[e] = r
+	}
+
+	return results
+}
+
+// replace swaps the stuck tx for the one with bumped fee, if the client is Replacer
+// and the tx has not been mined for the replace after. The replaced hash is returned.
+func (c *Confirmer) replace(ctx context.Context, e *entry, now int64) (string, error) {
+	r, ok := c.client.(Replacer)
+	if !ok || c.replaceAfter <= 0 || now < e.sentAt+int64(c.replaceAfter) || int(e.replaced) >= c.maxReplacements {
+		return "", nil
+	}
+
+	tx, ok := c.txs.get(e.hash)
+	if !ok {
+		return "", nil
+	}
+
+	// count failed attempts as well, not to replace endlessly
+	e.replaced++
+	e.sentAt = now
+
+	newTx, err := r.ReplaceTx(ctx, tx)
+	if err != nil {
+		return "", errors.Wrap(err, "err ReplaceTx")
+	}
+
+	newHash, err := c.client.SendTx(ctx, newTx)
+	if err != nil {
+		return "", errors.Wrap(err, "err SendTx")
+	}
+
+	oldHash := e.hash
+	e.prevHashes = append(e.prevHashes, oldHash)
+	e.hash = newHash
+	e.notFoundAt = 0
+
+	c.txs.set(newHash, newTx)
+	c.txs.delete(oldHash)
+	c.index.replaced(e)
+	c.statuses.replaced(oldHash, newHash)
+
+	c.logger.Info("tx replaced", LogKeyHash, oldHash, LogKeyNewHash, newHash, LogKeyAttempt, e.replaced)
+	ev := c.event(EventReplaced, e, newHash, now)
+	ev.PrevHash = oldHash
+	c.publish(ctx, ev)
+	if err = c.AfterTxReplaced(oldHash, newHash); err != nil {
+		c.metrics.HandlerError()
+		return oldHash, errors.Wrap(err, "err afterTxReplaced")
+	}
+
+	return oldHash, nil
+}
+
+// resend rebroadcasts the original tx if it has not been found
+// for the resend window, up to the max resends
+func (c *Confirmer) resend(ctx context.Context, e *entry, now int64) error {
+	if e.notFoundAt == 0 {
+		e.notFoundAt = now
+		return nil
+	}
+
+	if c.resendWindow <= 0 || now < e.notFoundAt+int64(c.resendWindow) || int(e.resent) >= c.maxResends {
+		return nil
+	}
+
+	// the original tx is unknown when enqueued by hash or resumed from the store
+	tx, ok := c.txs.get(e.hash)
+	if !ok {
+		return nil
+	}
+
+	// count failed attempts as well, not to resend endlessly
+	e.resent++
+	e.notFoundAt = now
+
+	if _, err := c.client.SendTx(ctx, tx); err != nil {
+		return errors.Wrap(err, "err SendTx")
 	}
 
-	for i := 0; i < c.workers; i++ {
-		id := i + 1
-		go worker(ctx, c, id)
+	c.logger.Info("tx resent", LogKeyHash, e.hash, LogKeyAttempt, e.resent)
+	c.publish(ctx, c.event(EventResent, e, e.hash, now))
+	if err := c.AfterTxResent(e.hash, int(e.resent)); err != nil {
+		c.metrics.HandlerError()
+		return errors.Wrap(err, "err afterTxResent")
 	}
 
-	fmt.Print("confirmer is ready\n")
 	return nil
 }
 
-func (c *Confirmer) Close(canncel context.CancelFunc) {
-	canncel()
-	for !c.closed() {
+// requeue persists and enqueues the entry, unless removed meanwhile.
+// Never overflows, as the capacity is reserved while tracked.
+// The queue is authoritative, so that enqueued even if failed to persist,
+// which is retried by the next requeue. The keys replaced are deleted once
+// the new one is persisted, not to lose the entry on crash.
+func (c *Confirmer) requeue(e *entry, now int64) error {
+	e.updatedAt = now
+
+	value, at := e.encode(), c.nextCheck(e)
+	err := c.index.ifTracked(e, func() error {
+		err := c.store.Put(e.hash, value)
+		if err != nil {
+			err = errors.Wrap(err, "err Put")
+		} else {
+			err = c.deleteStale(e)
+		}
+		// never touched once pushed, as popped by another worker
+		c.queue.push(e, at)
+		return err
+	})
+	if err != ErrNotTracked {
+		return err
+	}
+
+	// removed meanwhile, left the queue
+	c.slots.release()
+	return nil
+}
+
+// deleteStale deletes the keys replaced, keeping the failed ones to retry
+func (c *Confirmer) deleteStale(e *entry) error {
+	for len(e.staleKeys) > 0 {
+		if err := c.store.Delete(e.staleKeys[0]); err != nil {
+			return errors.Wrap(err, "err Delete")
+		}
+		e.staleKeys = e.staleKeys[1:]
 	}
-	fmt.Print("confirmer is closed\n")
+	return nil
 }
 
-func (c *Confirmer) withTimeout() (context.Context, context.CancelFunc) {
-	ctx := context.Background()
-	return context.WithTimeout(ctx, time.Duration(time.Duration(c.timeout)*time.Second))
+// resume enqueues the entries persisted in the store.
+// Entries tracked already are skipped. The ones beyond the queue size
+// are still resumed, as accepted already, making new ones wait.
+// The record left by a replaced hash is superseded by the one replacing it,
+// which is told by the longer replaced hashes, and deleted.
+func (c *Confirmer) resume() error {
+	var entries []*entry
+	err := c.store.Iterate(func(key string, value []byte) error {
+		e, err := decodeEntry(key, value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return len(entries[i].prevHashes) > len(entries[j].prevHashes)
+	})
+
+	var (
+		resumed    = make([]*entry, 0, len(entries))
+		keys       = make(map[string]*entry, len(entries))
+		overflowed = 0
+	)
+	for _, e := range entries {
+		key, ok := c.index.resume(e)
+		if !ok {
+			if key == e.hash {
+				continue
+			}
+			if err := c.store.Delete(e.hash); err != nil {
+				// retried by the next requeue of the superseding one
+				if r, ok := keys[key]; ok {
+					r.staleKeys = append(r.staleKeys, e.hash)
+					continue
+				}
+				return errors.Wrap(err, "err Delete")
+			}
+			continue
+		}
+
+		if !c.slots.force() {
+			overflowed++
+		}
+		resumed = append(resumed, e)
+		keys[e.hash] = e
+	}
+
+	for _, e := range resumed {
+		c.statuses.enqueued(e, TxQueued)
+		c.queue.push(e, c.nextCheck(e))
+	}
+
+	if overflowed > 0 {
+		c.logger.Error("queue overflowed by resumed entries", LogKeyQueueLen, c.QueueLen())
+	}
+	return nil
+}
+
+// now returns the current time in unix nano by the clock
+func (c *Confirmer) now() int64 {
+	return c.clock.Now().UnixNano()
+}
+
+func (c *Confirmer) QueueLen() int {
+	return c.queue.Len()
 }
 
-func (c *Confirmer) closing() bool {
-	return atomic.LoadUint32(&c.closeCounter) > 0
+// Status returns the status of the tx, which is either tracked or finished lately
+func (c *Confirmer) Status(hash string) (TxStatus, bool) {
+	return c.statuses.get(hash)
 }
 
-func (c *Confirmer) closed() bool {
-	return atomic.LoadUint32(&c.closeCounter) >= uint32(c.workers)
+// Pending iterates over the txs not finished yet, the oldest first
+func (c *Confirmer) Pending(fn func(TxStatus) error) error {
+	return c.statuses.pending(fn)
 }
@@ -0,0 +1,126 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// MockClient confirms every tx right away, the hash of which is the tx itself
+type MockClient struct{}
+
+func (c *MockClient) SendTx(ctx context.Context, tx interface{}) (string, error) {
+	hash := tx.(string)
+	return hash, nil
+}
+
+func (c *MockClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	return nil
+}
+
+// MockBatchClient is MockClient confirming the txs at once
+type MockBatchClient struct {
+	MockClient
+}
+
+func (c *MockBatchClient) ConfirmTxs(ctx context.Context, hashes []string, confirmationBlocks uint64) map[string]error {
+	errs := make(map[string]error, len(hashes))
+	for _, h := range hashes {
+		errs[h] = nil
+	}
+	return errs
+}
+
+func TestTimingOpt(t *testing.T) {
+	c := NewConfirmer(&MockClient{}, 0)
+	require.Equal(t, time.Second, c.confirmationInterval)
+	require.Equal(t, 10*time.Millisecond, c.workerInterval)
+	require.Equal(t, 60*time.Second, c.timeout)
+
+	// the deprecated ones keep their units
+	c = NewConfirmer(&MockClient{}, 0, ConfirmationInterval(2), WithWorkerInterval(100), Timeout(15), WithMaxAge(1))
+	require.Equal(t, 2*time.Second, c.confirmationInterval)
+	require.Equal(t, 100*time.Millisecond, c.workerInterval)
+	require.Equal(t, 15*time.Second, c.timeout)
+	require.Equal(t, time.Second, c.maxAge)
+
+	c = NewConfirmer(&MockClient{}, 0, WithConfirmationIntervalDuration(500*time.Millisecond), WithTimeoutDuration(time.Second))
+	require.Equal(t, 500*time.Millisecond, c.confirmationInterval)
+	require.Equal(t, time.Second, c.timeout)
+}
+
+func TestAfterTxSentFailure(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = NewMemoryStore()
+	)
+
+	c := NewConfirmer(&MockClient{}, 5, WithConfirmationInterval(0), WithStore(store),
+		WithAfterTxSent(func(h string) error {
+			return errors.New("db down")
+		}))
+
+	// tracked as broadcast already
+	err := c.EnqueueTx(ctx, "0x01")
+	require.ErrorContains(t, err, "db down")
+	require.True(t, c.Contains("0x01"))
+	require.Equal(t, 1, c.QueueLen())
+
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.False(t, c.Contains("0x01"))
+	require.Equal(t, 0, store.Len())
+	_, ok := c.txs.get("0x01")
+	require.False(t, ok)
+}
+
+func TestStaleCheck(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		store    = NewMemoryStore()
+		notified int
+	)
+
+	c := NewConfirmer(&MockClient{}, 5, WithConfirmationInterval(0), WithStore(store),
+		WithAfterTxConfirmedEvent(func(ctx context.Context, ev Event) error {
+			notified++
+			return nil
+		}),
+		WithAfterTxFailed(func(h string, err error) error {
+			notified++
+			return nil
+		}))
+
+	err := c.EnqueueTxHash(ctx, "0x01")
+	require.NoError(t, err)
+
+	// removed and tracked again while checked by a worker,
+	// so that the stale one never finishes the new one
+	for _, checked := range []error{nil, ErrTxFailed} {
+		e, _, err := c.dequeue(c.now(), 0)
+		require.NoError(t, err)
+		require.NotNil(t, e)
+		err = c.Remove("0x01")
+		require.NoError(t, err)
+		err = c.EnqueueTxHash(ctx, "0x01")
+		require.NoError(t, err)
+
+		_, err = c.settle(ctx, e, c.now(), 0, "0x01", checked)
+		require.NoError(t, err)
+		require.Equal(t, 0, notified)
+		require.True(t, c.Contains("0x01"))
+		require.Equal(t, 1, store.Len())
+		status, ok := c.Status("0x01")
+		require.True(t, ok)
+		require.Equal(t, TxQueued, status.State)
+	}
+
+	// the new one is confirmed by itself
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, notified)
+	require.Equal(t, 0, store.Len())
+}
@@ -1,142 +1,924 @@
-package confirm
+package confirm_test
 
 import (
 	"context"
 	"errors"
-	"sync"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+	"github.com/tak1827/transaction-confirmer/confirm/confirmtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type MockClient struct{}
+func TestClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := confirm.NewConfirmer(&confirm.MockClient{}, 0, confirm.WithWorkers(2), confirm.WithTimeout(3))
 
-func (c *MockClient) SendTx(ctx context.Context, tx interface{}) (string, error) {
-	hash := tx.(string)
-	return hash, nil
+	c.Start(ctx)
+	c.Close(cancel)
 }
 
-var MockClientError error
+// failingStore fails the given number of Puts and Deletes
+type failingStore struct {
+	*confirm.MemoryStore
+	fails       int32
+	deleteFails int32
+}
 
-func (c *MockClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
-	if MockClientError != nil {
-		return MockClientError
+func (s *failingStore) Put(key string, value []byte) error {
+	if atomic.AddInt32(&s.fails, -1) >= 0 {
+		return errors.New("disk full")
 	}
-	if time.Now().Unix()%2 == 0 {
-		return ErrTxConfirmPending
+	return s.MemoryStore.Put(key, value)
+}
+
+func (s *failingStore) Delete(key string) error {
+	if atomic.AddInt32(&s.deleteFails, -1) >= 0 {
+		return errors.New("disk full")
 	}
-	return nil
+	return s.MemoryStore.Delete(key)
 }
 
-func TestClose(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	c := NewConfirmer(&MockClient{}, 0, WithWorkers(2), WithTimeout(3))
+func TestRequeuePutFailure(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+		store = &failingStore{MemoryStore: confirm.NewMemoryStore()}
+	)
 
-	c.Start(ctx)
-	c.Close(cancel)
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(1)
+
+	// kept in the queue, persisted by the next requeue
+	atomic.StoreInt32(&store.fails, 1)
+	_, err = c.DequeueTx(ctx)
+	require.ErrorContains(t, err, "disk full")
+	require.True(t, c.Contains("0x01"))
+	require.Equal(t, 1, c.QueueLen())
+
+	chain.Mine(2)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.False(t, c.Contains("0x01"))
+	require.Equal(t, 0, store.Len())
 }
 
-type safeMap struct {
-	sync.Mutex
-	unsent      map[string]struct{}
-	unconfirmed map[string]struct{}
+func TestTxOpt(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		chain       = confirmtest.NewChain()
+		clock       = confirmtest.NewClock(genesis)
+		confirmed   = make(chan confirm.Event, 2)
+		expired     = make(chan string, 1)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithConfirmationBlock(2),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed <- ev
+			return nil
+		}),
+		confirm.WithAfterTxExpired(func(h string, age time.Duration) error {
+			expired <- h
+			return nil
+		}))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), "0x01", confirm.WithTxConfirmationBlocks(30), confirm.WithTxMetadata(map[string]string{"id": "1"}))
+	require.NoError(t, err)
+
+	// fall back to the confirmer's
+	_, err = chain.SendTx(context.Background(), "0x02")
+	require.NoError(t, err)
+	err = c.EnqueueTxHash(context.Background(), "0x02")
+	require.NoError(t, err)
+
+	chain.Mine(3)
+	ev := await(clock, time.Second, confirmed)
+	require.Equal(t, "0x02", ev.Hash)
+	require.Equal(t, uint64(2), ev.Confirmations)
+
+	chain.Mine(28)
+	ev = await(clock, time.Second, confirmed)
+	require.Equal(t, "0x01", ev.Hash)
+	require.Equal(t, uint64(30), ev.Confirmations)
+
+	// never mined
+	err = c.EnqueueTxHash(context.Background(), "0x03", confirm.WithTxDeadline(clock.Now()))
+	require.NoError(t, err)
+	require.Equal(t, "0x03", await(clock, time.Second, expired))
+
+	// rejected before sent, as never persisted
+	large := map[string]string{"memo": strings.Repeat("a", 1<<16)}
+	err = c.EnqueueTx(context.Background(), "0x04", confirm.WithTxMetadata(large))
+	require.ErrorIs(t, err, confirm.ErrMetadataTooLarge)
+	err = c.EnqueueTxHash(context.Background(), "0x04", confirm.WithTxMetadata(large))
+	require.ErrorIs(t, err, confirm.ErrMetadataTooLarge)
+	require.False(t, c.Contains("0x04"))
+	require.Equal(t, 0, chain.Sends("0x04"))
+
+	c.Close(cancel)
 }
 
-func (s *safeMap) deleteSent(hash string) {
-	s.Lock()
-	defer s.Unlock()
+func TestStatus(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		chain       = confirmtest.NewChain()
+		clock       = confirmtest.NewClock(genesis)
+		confirmed   = make(chan string, 2)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithResendWindow(0),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
+
+	err := c.EnqueueTx(context.Background(), "0x01")
+	require.NoError(t, err)
+	_, err = chain.SendTx(context.Background(), "0x02")
+	require.NoError(t, err)
+	err = c.EnqueueTxHash(context.Background(), "0x02")
+	require.NoError(t, err)
+
+	st, ok := c.Status("0x01")
+	require.True(t, ok)
+	require.Equal(t, confirm.TxSent, st.State)
+	st, _ = c.Status("0x02")
+	require.Equal(t, confirm.TxQueued, st.State)
+
+	_, ok = c.Status("0x03")
+	require.False(t, ok)
+
+	// not mined yet
+	_, err = c.DequeueTx(context.Background())
+	require.NoError(t, err)
+
+	st, _ = c.Status("0x01")
+	require.Equal(t, confirm.TxPending, st.State)
+	require.Equal(t, 1, st.Attempts)
+	require.ErrorIs(t, st.LastErr, confirm.ErrTxNotFound)
+	require.True(t, genesis.Equal(st.CheckedAt))
 
-	delete(s.unsent, hash)
+	var hashes []string
+	err = c.Pending(func(st confirm.TxStatus) error {
+		hashes = append(hashes, st.Hash)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"0x01", "0x02"}, hashes)
+
+	chain.Mine(3)
+
+	err = c.Start(ctx)
+	require.NoError(t, err)
+
+	await(clock, time.Second, confirmed)
+	await(clock, time.Second, confirmed)
+
+	c.Close(cancel)
+
+	st, _ = c.Status("0x01")
+	require.Equal(t, confirm.TxConfirmed, st.State)
+	require.NoError(t, st.LastErr)
+
+	hashes = nil
+	c.Pending(func(st confirm.TxStatus) error {
+		hashes = append(hashes, st.Hash)
+		return nil
+	})
+	require.Empty(t, hashes)
 }
 
-func (s *safeMap) deleteConfirmed(hash string) {
-	s.Lock()
-	defer s.Unlock()
+func TestStatusEnqueueFailure(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = &failingStore{MemoryStore: confirm.NewMemoryStore(), fails: 2}
+	)
+
+	c := confirm.NewConfirmer(confirmtest.NewChain(), 5, confirm.WithStore(store))
+
+	// not left as sent, nor queued
+	err := c.EnqueueTx(ctx, "0x01")
+	require.ErrorContains(t, err, "disk full")
+	err = c.EnqueueTxHash(ctx, "0x02")
+	require.ErrorContains(t, err, "disk full")
 
-	delete(s.unconfirmed, hash)
+	for _, hash := range []string{"0x01", "0x02"} {
+		_, ok := c.Status(hash)
+		require.False(t, ok)
+		require.False(t, c.Contains(hash))
+	}
+	err = c.Pending(func(st confirm.TxStatus) error {
+		t.Fatalf("unexpected pending %s", st.Hash)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, c.QueueLen())
 }
 
-func TestSendTxDequeueTx(t *testing.T) {
+func TestBatch(t *testing.T) {
 	var (
 		ctx, cancel = context.WithCancel(context.Background())
-		txs         = []string{
-			"0x01",
-			"0x02",
-			"0x03",
-			"0x04",
-			"0x05",
-		}
-		checker = safeMap{
-			unsent:      make(map[string]struct{}, len(txs)),
-			unconfirmed: make(map[string]struct{}, len(txs)),
-		}
-		sent = func(h string) error {
-			checker.deleteSent(h)
-			return nil
+		chain       = confirmtest.NewChain()
+		clock       = confirmtest.NewClock(genesis)
+		txs         = []string{"0x01", "0x02", "0x03"}
+		confirmed   = make(chan string, len(txs))
+		batches     int32
+		singles     int32
+	)
+
+	chain.Intercept(func(ctx context.Context, method string) error {
+		switch method {
+		case "ConfirmTxs":
+			atomic.AddInt32(&batches, 1)
+		case "ConfirmTx":
+			atomic.AddInt32(&singles, 1)
 		}
-		confirmedCounter = uint32(0)
-		confirmed        = func(h string) error {
-			checker.deleteConfirmed(h)
-			atomic.AddUint32(&confirmedCounter, 1)
+		return nil
+	})
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithBatchSize(len(txs)),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
 			return nil
+		}))
+
+	for _, tx := range txs {
+		err := c.EnqueueTx(context.Background(), tx)
+		require.NoError(t, err)
+	}
+	chain.Mine(3)
+
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	var got []string
+	for range txs {
+		got = append(got, await(clock, time.Second, confirmed))
+	}
+	require.ElementsMatch(t, txs, got)
+
+	c.Close(cancel)
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&batches))
+	require.Equal(t, int32(0), atomic.LoadInt32(&singles))
+
+	// confirmed one by one without BatchClient
+	txs = []string{"0x04", "0x05", "0x06"}
+	c = confirm.NewConfirmer(struct{ confirm.Client }{chain}, 5, confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithBatchSize(len(txs)))
+	for _, tx := range txs {
+		err := c.EnqueueTx(context.Background(), tx)
+		require.NoError(t, err)
+	}
+	chain.Mine(3)
+
+	errs := c.DequeueTxs(context.Background())
+	require.Empty(t, errs)
+	require.Equal(t, 0, c.QueueLen())
+	require.Equal(t, int32(1), atomic.LoadInt32(&batches))
+	require.Equal(t, int32(len(txs)), atomic.LoadInt32(&singles))
+}
+
+func TestShutdown(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		chain    = confirmtest.NewChain()
+		clock    = confirmtest.NewClock(genesis)
+		checking = make(chan struct{}, 1)
+		release  = make(chan struct{})
+	)
+
+	// blocks checking until released
+	chain.Intercept(func(ctx context.Context, method string) error {
+		if method == "ConfirmTxs" {
+			select {
+			case checking <- struct{}{}:
+			default:
+			}
+			<-release
 		}
+		return nil
+	})
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock), confirm.WithConfirmationInterval(0))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.Start(ctx)
+	require.ErrorIs(t, err, confirm.ErrAlreadyStarted)
+
+	err = c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	await(clock, time.Millisecond, checking)
+
+	// in-flight confirmation is not finished
+	sctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Shutdown(sctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+
+	remaining, err := c.Shutdown(ctx)
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	require.Equal(t, "0x01", remaining[0].Hash)
+
+	// no-op when already shut down
+	_, err = c.Shutdown(ctx)
+	require.NoError(t, err)
+
+	// restart
+	err = c.Start(ctx)
+	require.NoError(t, err)
+	_, err = c.Shutdown(ctx)
+	require.NoError(t, err)
+}
+
+func TestDrainOnShutdown(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chain     = confirmtest.NewChain()
+		clock     = confirmtest.NewClock(genesis)
+		confirmed = make(chan string, 1)
 	)
 
-	c := NewConfirmer(&MockClient{}, 5, WithWorkers(2), WithTimeout(3), WithAfterTxSent(sent), WithAfterTxConfirmed(confirmed))
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithDrainOnShutdown(true),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
 	err := c.Start(ctx)
 	require.NoError(t, err)
 
-	for _, tx := range txs {
-		checker.unsent[tx] = struct{}{}
-		checker.unconfirmed[tx] = struct{}{}
+	_, err = chain.SendTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(3)
+	err = c.EnqueueTxHash(ctx, "0x01")
+	require.NoError(t, err)
+
+	// confirmed by draining, as workers wait for the clock
+	remaining, err := c.Shutdown(ctx)
+	require.NoError(t, err)
+	require.Len(t, remaining, 0)
+
+	require.Equal(t, "0x01", <-confirmed)
+}
 
-		c.EnqueueTx(context.Background(), tx)
+func TestTrace(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+		exp   = tracetest.NewInMemoryExporter()
+		tp    = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+		calls []trace.SpanContext
+	)
+
+	// records the span of each call
+	chain.Intercept(func(ctx context.Context, method string) error {
+		calls = append(calls, trace.SpanContextFromContext(ctx))
+		return nil
+	})
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithTracerProvider(tp))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+
+	// rechecked with a fresh ctx like workers, confirmed on the second check
+	chain.Mine(1)
+	for i := 0; i < 2; i++ {
+		_, err = c.DequeueTx(context.Background())
+		require.NoError(t, err)
+		chain.Mine(2)
 	}
+	require.Equal(t, 0, c.QueueLen())
 
-	for {
-		if atomic.LoadUint32(&confirmedCounter) >= uint32(len(txs)) {
-			break
-		}
+	spans := exp.GetSpans()
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
 	}
+	require.Len(t, byName[confirm.SpanEnqueueTx], 1)
+	require.Len(t, byName[confirm.SpanSendTx], 1)
+	require.Len(t, byName[confirm.SpanRecheck], 2)
+	require.Len(t, byName[confirm.SpanConfirmTx], 2)
+	require.Len(t, byName[confirm.SpanAfterTxConfirmed], 1)
 
-	c.Close(cancel)
+	// every span belongs to the trace of the enqueue
+	root := byName[confirm.SpanEnqueueTx][0].SpanContext
+	for _, s := range spans {
+		require.Equal(t, root.TraceID(), s.SpanContext.TraceID(), s.Name)
+	}
+	for _, s := range byName[confirm.SpanRecheck] {
+		require.Equal(t, root.SpanID(), s.Parent.SpanID())
+	}
+	require.NotEmpty(t, calls)
+	for _, sc := range calls {
+		require.Equal(t, root.TraceID(), sc.TraceID())
+	}
+}
 
-	require.Equal(t, len(checker.unsent), 0)
-	require.Equal(t, len(checker.unconfirmed), 0)
+func TestRetry(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chain     = confirmtest.NewChain()
+		clock     = confirmtest.NewClock(genesis)
+		transient = errors.New("503 Service Unavailable")
+		unknown   = errors.New("unknown")
+		confirmed = 0
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithRetryBackoff(0),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed++
+			return nil
+		}))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(3)
+
+	// transient one is retried silently
+	chain.SetErrorRate(1, transient)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.QueueLen())
+	st, _ := c.Status("0x01")
+	require.Equal(t, confirm.TxPending, st.State)
+	require.Equal(t, transient, st.LastErr)
+
+	// unknown one is reported, but not dropped
+	chain.SetErrorRate(1, unknown)
+	_, err = c.DequeueTx(ctx)
+	require.ErrorIs(t, err, unknown)
+	require.Equal(t, 1, c.QueueLen())
+
+	chain.SetErrorRate(0, nil)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, confirmed)
+	require.Equal(t, 0, c.QueueLen())
+}
+
+func TestExpireOnErrors(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chain   = confirmtest.NewChain()
+		clock   = confirmtest.NewClock(genesis)
+		store   = confirm.NewMemoryStore()
+		errs    = []error{errors.New("unknown"), errors.New("503 Service Unavailable")}
+		expired []string
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store),
+		confirm.WithAfterTxExpired(func(h string, age time.Duration) error {
+			expired = append(expired, h)
+			return nil
+		}))
+
+	// expired instead of retried
+	for i, tx := range []string{"0x01", "0x02"} {
+		err := c.EnqueueTx(ctx, tx, confirm.WithTxDeadline(time.Unix(1, 0)))
+		require.NoError(t, err)
+
+		chain.SetErrorRate(1, errs[i])
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+		chain.SetErrorRate(0, nil)
+
+		st, _ := c.Status(tx)
+		require.Equal(t, confirm.TxExpired, st.State)
+	}
+	require.Equal(t, []string{"0x01", "0x02"}, expired)
+	require.Equal(t, 0, c.QueueLen())
+	require.Equal(t, 0, store.Len())
 }
 
-func TestErrHandle(t *testing.T) {
+func TestAfterTxFailed(t *testing.T) {
 	var (
-		ctx, cancel  = context.WithCancel(context.Background())
-		expectedHash = "0x01"
-		expectedErr  = ErrTxFailed
-		closing      = make(chan struct{})
-		errHandler   = func(h string, err error) {
-			defer close(closing)
+		ctx    = context.Background()
+		chain  = confirmtest.NewChain()
+		clock  = confirmtest.NewClock(genesis)
+		store  = confirm.NewMemoryStore()
+		failed = make(map[string]error)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store),
+		confirm.WithAfterTxFailed(func(h string, err error) error {
+			failed[h] = err
+			return nil
+		}))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Fail("0x01")
+	chain.Mine(1)
+
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(t, failed["0x01"], confirm.ErrTxFailed)
+	require.Equal(t, 0, c.QueueLen())
+	require.Equal(t, 0, store.Len())
+
+	st, _ := c.Status("0x01")
+	require.Equal(t, confirm.TxFailed, st.State)
+}
 
-			if !errors.Is(err, expectedErr) {
-				panic("unexpected error")
+func TestEvent(t *testing.T) {
+	type ctxKey struct{}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		chain       = confirmtest.NewChain()
+		clock       = confirmtest.NewClock(genesis)
+		meta        = map[string]string{"id": "1"}
+		sent        confirm.Event
+		confirmed   = make(chan confirm.Event, 1)
+		failed      = make(chan confirm.Event, 1)
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock), confirm.WithConfirmationInterval(0),
+		confirm.WithAfterTxSentEvent(func(ctx context.Context, ev confirm.Event) error {
+			require.Equal(t, "enqueue", ctx.Value(ctxKey{}))
+			sent = ev
+			return nil
+		}),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed <- ev
+			return nil
+		}),
+		// only the first error matters, as retried
+		confirm.WithErrEventHandler(func(ctx context.Context, ev confirm.Event) {
+			select {
+			case failed <- ev:
+			default:
 			}
+		}))
+
+	err := c.EnqueueTx(context.WithValue(ctx, ctxKey{}, "enqueue"), "0x01", confirm.WithTxMetadata(meta))
+	require.NoError(t, err)
+	require.Equal(t, confirm.Event{Type: confirm.EventSent, Hash: "0x01", Tx: "0x01", Metadata: meta}, sent)
+	chain.Mine(3)
+
+	err = c.Start(ctx)
+	require.NoError(t, err)
 
-			if h != expectedHash {
-				panic("unexpected hash")
+	ev := await(clock, time.Second, confirmed)
+	require.Equal(t, "0x01", ev.Hash)
+	require.Equal(t, "0x01", ev.Tx)
+	require.Equal(t, meta, ev.Metadata)
+	require.Equal(t, uint64(1), ev.BlockNumber)
+	require.Equal(t, confirmtest.GasUsed, ev.GasUsed)
+	require.Equal(t, confirm.DEFAULT_CONFIEMATION_BLOCKS, ev.Confirmations)
+	require.Equal(t, 1, ev.Attempts)
+
+	// sent elsewhere, failing to check
+	_, err = chain.SendTx(ctx, "0x02")
+	require.NoError(t, err)
+	chain.SetErrorRate(1, errors.New("unknown"))
+	err = c.EnqueueTxHash(ctx, "0x02", confirm.WithTxMetadata(meta))
+	require.NoError(t, err)
+
+	ev = await(clock, time.Second, failed)
+	require.Equal(t, "0x02", ev.Hash)
+	require.Equal(t, meta, ev.Metadata)
+	require.Equal(t, 1, ev.Attempts)
+	require.Error(t, ev.Err)
+
+	c.Close(cancel)
+	chain.SetErrorRate(0, nil)
+
+	// the handlers of the hash still work
+	var (
+		hctx, hcancel = context.WithCancel(context.Background())
+		hashes        = make(chan string, 2)
+	)
+	c = confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock), confirm.WithConfirmationInterval(0),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			hashes <- h
+			return nil
+		}),
+		confirm.WithErrHandler(func(h string, err error) {
+			select {
+			case hashes <- h:
+			default:
 			}
+		}))
+
+	require.NoError(t, c.EnqueueTx(ctx, "0x03"))
+	chain.Mine(3)
+	err = c.Start(hctx)
+	require.NoError(t, err)
+	require.Equal(t, "0x03", await(clock, time.Second, hashes))
+
+	chain.SetErrorRate(1, errors.New("unknown"))
+	require.NoError(t, c.EnqueueTxHash(ctx, "0x02"))
+	require.Equal(t, "0x02", await(clock, time.Second, hashes))
+
+	c.Close(hcancel)
+}
+
+func TestHandlerRetry(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chain   = confirmtest.NewChain()
+		clock   = confirmtest.NewClock(genesis)
+		store   = confirm.NewMemoryStore()
+		checks  = 0
+		handled = 0
+		failing = 2
+	)
+
+	chain.Intercept(func(ctx context.Context, method string) error {
+		if method == "ConfirmTx" {
+			checks++
 		}
+		return nil
+	})
+
+	handler := confirm.WithAfterTxConfirmed(func(h string) error {
+		handled++
+		if handled <= failing {
+			return errors.New("db down")
+		}
+		return nil
+	})
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithRetryBackoff(0), confirm.WithStore(store), handler)
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(3)
+
+	_, err = c.DequeueTx(ctx)
+	require.ErrorContains(t, err, "err afterTxConfirmed")
+	st, _ := c.Status("0x01")
+	require.Equal(t, confirm.TxHandlerPending, st.State)
+	require.Equal(t, 1, store.Len())
+
+	// resumed after restart, still retrying the handler
+	c = confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithRetryBackoff(0), confirm.WithStore(store), handler)
+	require.NoError(t, c.Resume())
+
+	_, err = c.DequeueTx(ctx)
+	require.Error(t, err)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	require.Equal(t, 3, handled)
+	require.Equal(t, 1, checks)
+	require.Equal(t, 0, store.Len())
+	st, _ = c.Status("0x01")
+	require.Equal(t, confirm.TxConfirmed, st.State)
+
+	// dead-lettered after exhausted
+	handled, failing = 0, 10
+	c = confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithRetryBackoff(0), confirm.WithStore(store), confirm.WithMaxHandlerAttempts(2), handler)
+
+	err = c.EnqueueTx(ctx, "0x02")
+	require.NoError(t, err)
+	chain.Mine(3)
+	_, err = c.DequeueTx(ctx)
+	require.Error(t, err)
+	_, err = c.DequeueTx(ctx)
+	require.ErrorContains(t, err, "handler attempts exhausted")
+
+	require.Equal(t, 0, c.QueueLen())
+	require.Equal(t, 0, store.Len())
+	d, err := c.DeadLetter("0x02")
+	require.NoError(t, err)
+	require.Contains(t, d.Err, "db down")
+}
+
+func TestDuplicate(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		chain     = confirmtest.NewChain()
+		clock     = confirmtest.NewClock(genesis)
+		store     = confirm.NewMemoryStore()
+		confirmed []confirm.Event
 	)
 
-	// set error
-	MockClientError = ErrTxFailed
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed = append(confirmed, ev)
+			return nil
+		}))
 
-	c := NewConfirmer(&MockClient{}, 5, WithWorkers(1), WithErrHandler(errHandler))
-	err := c.Start(ctx)
+	err := c.EnqueueTx(ctx, "0x01")
 	require.NoError(t, err)
+	err = c.EnqueueTxHash(ctx, "0x01")
+	require.ErrorIs(t, err, confirm.ErrAlreadyTracked)
+	err = c.EnqueueTx(ctx, "0x01")
+	require.ErrorIs(t, err, confirm.ErrAlreadyTracked)
+	require.True(t, c.Contains("0x01"))
+	require.Equal(t, 1, c.QueueLen())
 
-	c.EnqueueTx(context.Background(), expectedHash)
+	chain.Mine(3)
+	for c.QueueLen() > 0 {
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+	}
+	require.Len(t, confirmed, 1)
+	require.False(t, c.Contains("0x01"))
 
-	<-closing
+	// removed one is dropped, even if enqueued again
+	err = c.EnqueueTxHash(ctx, "0x02")
+	require.NoError(t, err)
+	err = c.Remove("0x02")
+	require.NoError(t, err)
+	require.False(t, c.Contains("0x02"))
+	require.Equal(t, 0, store.Len())
+	err = c.Remove("0x02")
+	require.ErrorIs(t, err, confirm.ErrNotTracked)
 
-	c.Close(cancel)
-	MockClientError = nil
+	err = c.EnqueueTxHash(ctx, "0x02")
+	require.NoError(t, err)
+	require.Equal(t, 1, c.QueueLen())
+	require.Equal(t, 1, store.Len())
+	_, err = chain.SendTx(ctx, "0x02")
+	require.NoError(t, err)
+	chain.Mine(3)
+	for c.QueueLen() > 0 {
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+	}
+	require.Len(t, confirmed, 2)
+
+	// merged into the tracked one
+	c = confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithDuplicate(confirm.DuplicateMerge),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed = append(confirmed, ev)
+			return nil
+		}))
+
+	err = c.EnqueueTxHash(ctx, "0x03", confirm.WithTxMetadata(map[string]string{"id": "1"}))
+	require.NoError(t, err)
+	err = c.EnqueueTx(ctx, "0x03", confirm.WithTxMetadata(map[string]string{"memo": "2"}))
+	require.NoError(t, err)
+	require.Equal(t, 1, c.QueueLen())
+
+	chain.Mine(3)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 3)
+	require.Equal(t, map[string]string{"id": "1", "memo": "2"}, confirmed[2].Metadata)
+	require.Equal(t, "0x03", confirmed[2].Tx)
+}
+
+func TestBackpressure(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+	)
+
+	c := confirm.NewConfirmer(chain, 1, confirm.WithClock(clock), confirm.WithConfirmationInterval(0))
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+
+	// rejected before sent
+	err = c.TryEnqueue(ctx, "0x02")
+	require.ErrorIs(t, err, confirm.ErrQueueFull)
+	err = c.EnqueueTx(ctx, "0x02")
+	require.ErrorIs(t, err, confirm.ErrQueueFull)
+	err = c.EnqueueTxHash(ctx, "0x02")
+	require.ErrorIs(t, err, confirm.ErrQueueFull)
+	require.Equal(t, 0, chain.Sends("0x02"))
+
+	// requeued regardless of the capacity
+	for i := 0; i < 3; i++ {
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, c.QueueLen())
+
+	c = confirm.NewConfirmer(chain, 1, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithBlockingEnqueue(true))
+
+	err = c.EnqueueTx(ctx, "0x03")
+	require.NoError(t, err)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = c.EnqueueTx(cctx, "0x02")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 0, chain.Sends("0x02"))
+
+	// waits until the confirmed one frees the capacity
+	done := make(chan error)
+	go func() {
+		done <- c.EnqueueTx(ctx, "0x02")
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("should block")
+	default:
+	}
+
+	chain.Mine(3)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, <-done)
+	require.True(t, c.Contains("0x02"))
+	require.Equal(t, 1, chain.Sends("0x02"))
+}
+
+func TestResumeOverflow(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+		store = confirm.NewMemoryStore()
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithStore(store))
+	for _, tx := range []string{"0x01", "0x02", "0x03"} {
+		err := c.EnqueueTx(ctx, tx)
+		require.NoError(t, err)
+	}
+
+	// resumed beyond the queue size
+	c = confirm.NewConfirmer(chain, 1, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store))
+	err := c.Resume()
+	require.NoError(t, err)
+	require.Equal(t, 3, c.QueueLen())
+
+	// new ones wait until back within the size
+	chain.Mine(3)
+	for i := 0; i < 3; i++ {
+		err = c.TryEnqueue(ctx, "0x04")
+		require.ErrorIs(t, err, confirm.ErrQueueFull)
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+	}
+	err = c.TryEnqueue(ctx, "0x04")
+	require.NoError(t, err)
+}
+
+func TestResumeReplaced(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+		store = &failingStore{MemoryStore: confirm.NewMemoryStore()}
+	)
+
+	// crashed before the replaced one is deleted
+	for _, e := range [][]string{{"0x01"}, {"0x02", "0x01"}, {"0x03"}} {
+		err := confirm.PutEntry(store, e[0], genesis, e[1:]...)
+		require.NoError(t, err)
+	}
+
+	// pending while checked
+	for _, tx := range []string{"0x02", "0x03"} {
+		_, err := chain.SendTx(ctx, tx)
+		require.NoError(t, err)
+	}
+	chain.Mine(1)
+
+	// kept to delete by the next requeue, if failed
+	atomic.StoreInt32(&store.deleteFails, 1)
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0), confirm.WithStore(store))
+	err := c.Resume()
+	require.NoError(t, err)
+	require.Equal(t, 2, c.QueueLen())
+	require.True(t, c.Contains("0x01"))
+	require.Equal(t, 3, store.Len())
+
+	for c.QueueLen() > 0 && store.Len() > 2 {
+		_, err = c.DequeueTx(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, c.QueueLen())
+	require.Equal(t, 2, store.Len())
+
+	// deleted right away on resume
+	c = confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithStore(store))
+	err = confirm.PutEntry(store, "0x01", genesis)
+	require.NoError(t, err)
+	err = c.Resume()
+	require.NoError(t, err)
+	require.Equal(t, 2, c.QueueLen())
+	require.Equal(t, 2, store.Len())
 }
@@ -0,0 +1,434 @@
+package confirmtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+const (
+	GasUsed = uint64(21000) // reported by every receipt
+
+	headBuffer = 64
+)
+
+// ErrRPC is injected by the error rate unless the error is given
+var ErrRPC = errors.New("injected rpc error")
+
+var (
+	_ confirm.Client          = (*Chain)(nil)
+	_ confirm.BatchClient     = (*Chain)(nil)
+	_ confirm.BlockReporter   = (*Chain)(nil)
+	_ confirm.ReceiptReporter = (*Chain)(nil)
+	_ confirm.HeadSubscriber  = (*Chain)(nil)
+)
+
+// Chain is an in-memory chain implementing confirm.Client, scripted by tests.
+// Sent txs wait in the mempool until mined by Mine. The hash of a string tx is
+// the string itself, otherwise derived from the printed tx, so that resending
+// the same tx results in the same hash.
+type Chain struct {
+	mu sync.Mutex
+
+	blocks  []block // canonical, the number of blocks[i] is i+1
+	mempool []string
+	txs     map[string]*tx
+	subs    map[chan uint64]struct{}
+	fork    uint64 // bumped by each reorg, making block hashes differ
+
+	rand      *rand.Rand
+	errRate   float64
+	err       error
+	intercept func(ctx context.Context, method string) error
+}
+
+type block struct {
+	hash string
+	txs  []string
+}
+
+type tx struct {
+	sends  int
+	sent   bool   // in the mempool or mined
+	block  uint64 // mined at, zero while pending
+	delay  int    // blocks to be skipped
+	failed bool   // reverted when mined
+}
+
+// NewChain returns the chain at the genesis, seeded to inject errors reproducibly
+func NewChain() *Chain {
+	return &Chain{
+		txs:  make(map[string]*tx),
+		subs: make(map[chan uint64]struct{}),
+		rand: rand.New(rand.NewSource(1)),
+	}
+}
+
+// Hash returns the hash given to the tx by SendTx
+func Hash(raw interface{}) string {
+	if s, ok := raw.(string); ok {
+		return s
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", raw)))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// SendTx adds the tx to the mempool. Resending the dropped one adds it again.
+func (c *Chain) SendTx(ctx context.Context, raw interface{}) (string, error) {
+	if err := c.call(ctx, "SendTx"); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return "", err
+	}
+
+	hash := Hash(raw)
+	t := c.tx(hash)
+	t.sends++
+	if !t.sent {
+		t.sent = true
+		c.mempool = append(c.mempool, hash)
+	}
+	return hash, nil
+}
+
+// ConfirmTx confirms the tx mined the confirmation blocks before the head.
+// ErrTxNotFound is returned unless mined, PendingError until deep enough.
+func (c *Chain) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	if err := c.call(ctx, "ConfirmTx"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return err
+	}
+	return c.confirm(hash, confirmationBlocks)
+}
+
+// ConfirmTxs confirms the txs at once, failing all by the injected error
+func (c *Chain) ConfirmTxs(ctx context.Context, hashes []string, confirmationBlocks uint64) map[string]error {
+	if err := c.call(ctx, "ConfirmTxs"); err != nil {
+		return failAll(hashes, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return failAll(hashes, err)
+	}
+
+	errs := make(map[string]error, len(hashes))
+	for _, hash := range hashes {
+		errs[hash] = c.confirm(hash, confirmationBlocks)
+	}
+	return errs
+}
+
+// TxBlock returns the block including the tx, ErrTxNotFound unless mined
+func (c *Chain) TxBlock(ctx context.Context, hash string) (uint64, string, error) {
+	if err := c.call(ctx, "TxBlock"); err != nil {
+		return 0, "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return 0, "", err
+	}
+
+	t, ok := c.txs[hash]
+	if !ok || t.block == 0 {
+		return 0, "", confirm.ErrTxNotFound
+	}
+	return t.block, c.blocks[t.block-1].hash, nil
+}
+
+// TxReceipt returns the receipt of the mined tx, ErrTxNotFound unless mined
+func (c *Chain) TxReceipt(ctx context.Context, hash string) (confirm.Receipt, error) {
+	if err := c.call(ctx, "TxReceipt"); err != nil {
+		return confirm.Receipt{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return confirm.Receipt{}, err
+	}
+
+	t, ok := c.txs[hash]
+	if !ok || t.block == 0 {
+		return confirm.Receipt{}, confirm.ErrTxNotFound
+	}
+	return confirm.Receipt{
+		BlockNumber: t.block,
+		BlockHash:   c.blocks[t.block-1].hash,
+		GasUsed:     GasUsed,
+	}, nil
+}
+
+// SubscribeHeads sends the head of each mined block until the ctx is done.
+// Older heads are dropped if not received in time.
+func (c *Chain) SubscribeHeads(ctx context.Context) (<-chan uint64, error) {
+	if err := c.call(ctx, "SubscribeHeads"); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.inject(); err != nil {
+		return nil, err
+	}
+
+	heads := make(chan uint64, headBuffer)
+	c.subs[heads] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.subs, heads)
+		close(heads)
+	}()
+
+	return heads, nil
+}
+
+// Mine mines the blocks, including the txs in the mempool unless delayed.
+// Returns the new head.
+func (c *Chain) Mine(n int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		c.mine()
+	}
+	return uint64(len(c.blocks))
+}
+
+// Head returns the latest block number
+func (c *Chain) Head() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return uint64(len(c.blocks))
+}
+
+// Reorg replaces the latest blocks by the same number of new ones.
+// The txs included are mined again in the first new block, except the excluded ones,
+// which are dropped, not to be mined until resent.
+func (c *Chain) Reorg(depth int, exclude ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if depth > len(c.blocks) {
+		depth = len(c.blocks)
+	}
+
+	var orphaned []string
+	for _, b := range c.blocks[len(c.blocks)-depth:] {
+		orphaned = append(orphaned, b.txs...)
+	}
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	c.fork++
+
+	for _, hash := range orphaned {
+		c.txs[hash].block = 0
+	}
+	c.mempool = append(orphaned, c.mempool...)
+	for _, hash := range exclude {
+		c.drop(hash)
+	}
+
+	for i := 0; i < depth; i++ {
+		c.mine()
+	}
+}
+
+// Drop removes the pending tx from the mempool, as if evicted.
+// Reports false if not pending.
+func (c *Chain) Drop(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.drop(hash)
+}
+
+// Fail makes the tx reverted when mined, including the one mined already
+func (c *Chain) Fail(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tx(hash).failed = true
+}
+
+// Delay keeps the tx in the mempool while mining the blocks.
+// Scriptable before sent.
+func (c *Chain) Delay(hash string, blocks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tx(hash).delay = blocks
+}
+
+// SetErrorRate makes each call fail by the error at the rate from 0 to 1.
+// ErrRPC is injected if the error is nil.
+func (c *Chain) SetErrorRate(rate float64, err error) {
+	if rate < 0 || rate > 1 {
+		panic("error rate should be from 0 to 1")
+	}
+	if err == nil {
+		err = ErrRPC
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errRate, c.err = rate, err
+}
+
+// Intercept calls the fn before each call, with the name of the method called.
+// The call waits while the fn blocks, failing by the error returned. Nil removes it.
+func (c *Chain) Intercept(fn func(ctx context.Context, method string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.intercept = fn
+}
+
+// Sends returns how many times the tx is sent, including resends
+func (c *Chain) Sends(hash string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.txs[hash]; ok {
+		return t.sends
+	}
+	return 0
+}
+
+// Pending returns the hashes in the mempool, the oldest first
+func (c *Chain) Pending() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.mempool...)
+}
+
+func (c *Chain) tx(hash string) *tx {
+	t, ok := c.txs[hash]
+	if !ok {
+		t = &tx{}
+		c.txs[hash] = t
+	}
+	return t
+}
+
+func (c *Chain) confirm(hash string, confirmationBlocks uint64) error {
+	// no receipt while in the mempool, the same as a real node
+	t, ok := c.txs[hash]
+	if !ok || t.block == 0 {
+		return confirm.ErrTxNotFound
+	}
+	if t.failed {
+		return confirm.ErrTxFailed
+	}
+	if head := uint64(len(c.blocks)); t.block+confirmationBlocks > head {
+		return confirm.ConfirmPending(t.block, head)
+	}
+	return nil
+}
+
+func (c *Chain) mine() {
+	var (
+		number  = uint64(len(c.blocks) + 1)
+		b       = block{hash: fmt.Sprintf("0x%016x%016x", c.fork, number)}
+		mempool = c.mempool[:0]
+	)
+
+	for _, hash := range c.mempool {
+		t := c.txs[hash]
+		if t.delay > 0 {
+			t.delay--
+			mempool = append(mempool, hash)
+			continue
+		}
+		t.block = number
+		b.txs = append(b.txs, hash)
+	}
+	c.mempool = mempool
+	c.blocks = append(c.blocks, b)
+
+	for heads := range c.subs {
+		// the latest head matters, the oldest is dropped
+		select {
+		case heads <- number:
+			continue
+		default:
+		}
+		select {
+		case <-heads:
+		default:
+		}
+		select {
+		case heads <- number:
+		default:
+		}
+	}
+}
+
+func (c *Chain) drop(hash string) bool {
+	for i, h := range c.mempool {
+		if h == hash {
+			c.mempool = append(c.mempool[:i], c.mempool[i+1:]...)
+			c.txs[hash].sent = false
+			return true
+		}
+	}
+	return false
+}
+
+// call calls the intercepting fn out of the lock, so that blocking only the call
+func (c *Chain) call(ctx context.Context, method string) error {
+	c.mu.Lock()
+	fn := c.intercept
+	c.mu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+	return fn(ctx, method)
+}
+
+func (c *Chain) inject() error {
+	if c.errRate > 0 && c.rand.Float64() < c.errRate {
+		return c.err
+	}
+	return nil
+}
+
+func failAll(hashes []string, err error) map[string]error {
+	errs := make(map[string]error, len(hashes))
+	for _, hash := range hashes {
+		errs[hash] = err
+	}
+	return errs
+}
@@ -0,0 +1,168 @@
+package confirmtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+func TestChain(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = NewChain()
+	)
+
+	hash, err := chain.SendTx(ctx, "0x01")
+	require.NoError(t, err)
+	require.Equal(t, "0x01", hash)
+
+	// hashed by the content
+	type rawTx struct{ Nonce int }
+	hash, err = chain.SendTx(ctx, rawTx{Nonce: 1})
+	require.NoError(t, err)
+	require.Equal(t, Hash(rawTx{Nonce: 1}), hash)
+	require.NotEqual(t, Hash(rawTx{Nonce: 2}), hash)
+
+	chain.Delay(hash, 1)
+	require.ErrorIs(t, chain.ConfirmTx(ctx, "0x01", 0), confirm.ErrTxNotFound)
+
+	require.Equal(t, uint64(1), chain.Mine(1))
+	require.NoError(t, chain.ConfirmTx(ctx, "0x01", 0))
+	err = chain.ConfirmTx(ctx, "0x01", 1)
+	require.ErrorIs(t, err, confirm.ErrTxConfirmPending)
+	require.Equal(t, &confirm.PendingError{BlockNumber: 1}, err)
+	require.Equal(t, []string{hash}, chain.Pending())
+
+	chain.Mine(1)
+	require.Empty(t, chain.Pending())
+	require.NoError(t, chain.ConfirmTx(ctx, "0x01", 1))
+
+	number, _, err := chain.TxBlock(ctx, "0x01")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), number)
+
+	r, err := chain.TxReceipt(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), r.BlockNumber)
+	require.Equal(t, GasUsed, r.GasUsed)
+
+	errs := chain.ConfirmTxs(ctx, []string{"0x01", hash, "0x09"}, 1)
+	require.Equal(t, map[string]error{"0x01": nil, hash: confirm.ConfirmPending(2, 2), "0x09": confirm.ErrTxNotFound}, errs)
+
+	// reverted
+	chain.Fail("0x01")
+	require.ErrorIs(t, chain.ConfirmTx(ctx, "0x01", 0), confirm.ErrTxFailed)
+
+	// dropped until resent
+	_, err = chain.SendTx(ctx, "0x02")
+	require.NoError(t, err)
+	require.True(t, chain.Drop("0x02"))
+	require.False(t, chain.Drop("0x02"))
+	chain.Mine(1)
+	require.ErrorIs(t, chain.ConfirmTx(ctx, "0x02", 0), confirm.ErrTxNotFound)
+	_, err = chain.SendTx(ctx, "0x02")
+	require.NoError(t, err)
+	require.Equal(t, 2, chain.Sends("0x02"))
+	chain.Mine(1)
+	require.NoError(t, chain.ConfirmTx(ctx, "0x02", 0))
+
+	// mined again in the first new block
+	chain.Reorg(3)
+	require.Equal(t, uint64(4), chain.Head())
+	number, blockHash, err := chain.TxBlock(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), number)
+	require.NotEqual(t, r.BlockHash, blockHash)
+	number, _, err = chain.TxBlock(ctx, "0x02")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), number)
+
+	// excluded one is dropped
+	chain.Reorg(3, "0x02")
+	_, _, err = chain.TxBlock(ctx, "0x02")
+	require.ErrorIs(t, err, confirm.ErrTxNotFound)
+	require.Empty(t, chain.Pending())
+}
+
+func TestChainErrorRate(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = NewChain()
+	)
+
+	chain.SetErrorRate(1, nil)
+	_, err := chain.SendTx(ctx, "0x01")
+	require.ErrorIs(t, err, ErrRPC)
+
+	chain.SetErrorRate(0.5, nil)
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if err := chain.ConfirmTx(ctx, "0x01", 0); err == ErrRPC {
+			failed++
+		}
+	}
+	require.InDelta(t, 500, failed, 100)
+
+	chain.SetErrorRate(0, nil)
+	_, err = chain.SendTx(ctx, "0x01")
+	require.NoError(t, err)
+}
+
+func TestChainIntercept(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		chain   = NewChain()
+		unknown = errors.New("unknown")
+		calls   []string
+	)
+
+	chain.Intercept(func(ctx context.Context, method string) error {
+		calls = append(calls, method)
+		if method == "ConfirmTxs" {
+			return unknown
+		}
+		return nil
+	})
+
+	_, err := chain.SendTx(ctx, "0x01")
+	require.NoError(t, err)
+	chain.Mine(1)
+	require.NoError(t, chain.ConfirmTx(ctx, "0x01", 0))
+	errs := chain.ConfirmTxs(ctx, []string{"0x01"}, 0)
+	require.Equal(t, map[string]error{"0x01": unknown}, errs)
+	require.Equal(t, []string{"SendTx", "ConfirmTx", "ConfirmTxs"}, calls)
+
+	chain.Intercept(nil)
+	errs = chain.ConfirmTxs(ctx, []string{"0x01"}, 0)
+	require.Equal(t, map[string]error{"0x01": nil}, errs)
+	require.Len(t, calls, 3)
+}
+
+func TestChainSubscribeHeads(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		chain       = NewChain()
+	)
+
+	heads, err := chain.SubscribeHeads(ctx)
+	require.NoError(t, err)
+
+	chain.Mine(2)
+	require.Equal(t, uint64(1), <-heads)
+	require.Equal(t, uint64(2), <-heads)
+
+	// the latest head is kept when not received
+	chain.Mine(headBuffer + 1)
+	var last uint64
+	for i := 0; i < headBuffer; i++ {
+		last = <-heads
+	}
+	require.Equal(t, chain.Head(), last)
+
+	cancel()
+	_, ok := <-heads
+	require.False(t, ok)
+}
@@ -0,0 +1,156 @@
+// Package confirmtest provides a fake clock and a simulated chain
+// for testing with the confirmer without a real node
+package confirmtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock, moved only by Advance or Set.
+// Timers fire when the clock passes their time.
+type Clock struct {
+	mu sync.Mutex
+
+	cond    *sync.Cond
+	now     time.Time
+	timers  []*timer
+	waiters []waiter
+}
+
+type timer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+type waiter struct {
+	n int
+	c chan struct{}
+}
+
+// NewClock returns the fake clock starting at the time
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns the timer fired when the clock advances by the duration.
+// Fired right away unless the duration is positive.
+func (c *Clock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	c.notify()
+
+	return t.c, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		return c.remove(t)
+	}
+}
+
+// Advance moves the clock forward, firing timers in order of their time
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to the time, firing timers passed
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(now)
+}
+
+// Timers returns the number of timers not fired nor stopped
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// BlockUntil waits until the number of timers reaches n,
+// such as until workers are waiting for the clock
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Waiting returns the channel closed once the number of timers reaches n,
+// so that waiting for workers is selected with other events
+func (c *Clock) Waiting(n int) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := waiter{n: n, c: make(chan struct{})}
+	c.waiters = append(c.waiters, w)
+	c.notify()
+	return w.c
+}
+
+func (c *Clock) notify() {
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if len(c.timers) >= w.n {
+			close(w.c)
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	c.waiters = waiters
+}
+
+func (c *Clock) set(now time.Time) {
+	c.now = now
+
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].at.Before(c.timers[j].at)
+	})
+
+	n := 0
+	for _, t := range c.timers {
+		if t.at.After(now) {
+			break
+		}
+		t.c <- now
+		n++
+	}
+	c.timers = c.timers[n:]
+}
+
+func (c *Clock) remove(t *timer) bool {
+	for i := range c.timers {
+		if c.timers[i] == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
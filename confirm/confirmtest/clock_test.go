@@ -0,0 +1,71 @@
+package confirmtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(100, 0)
+	c := NewClock(start)
+	require.Equal(t, start, c.Now())
+
+	t1, _ := c.NewTimer(2 * time.Second)
+	t2, stop2 := c.NewTimer(time.Second)
+	require.Equal(t, 2, c.Timers())
+
+	// not fired until advanced
+	select {
+	case <-t1:
+		t.Fatal("fired early")
+	default:
+	}
+
+	c.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), <-t2)
+	require.False(t, stop2())
+	require.Equal(t, 1, c.Timers())
+
+	c.Set(start.Add(3 * time.Second))
+	require.Equal(t, start.Add(3*time.Second), <-t1)
+	require.Equal(t, 0, c.Timers())
+
+	// stopped before fired
+	t3, stop3 := c.NewTimer(time.Second)
+	require.True(t, stop3())
+	c.Advance(time.Second)
+	select {
+	case <-t3:
+		t.Fatal("fired after stopped")
+	default:
+	}
+
+	// fired right away
+	t4, _ := c.NewTimer(0)
+	require.Equal(t, start.Add(4*time.Second), <-t4)
+
+	done := make(chan struct{})
+	go func() {
+		c.BlockUntil(1)
+		close(done)
+	}()
+	c.NewTimer(time.Second)
+	<-done
+
+	// closed right away if reached
+	select {
+	case <-c.Waiting(1):
+	default:
+		t.Fatal("not closed")
+	}
+	waiting := c.Waiting(2)
+	select {
+	case <-waiting:
+		t.Fatal("closed early")
+	default:
+	}
+	c.NewTimer(time.Second)
+	<-waiting
+}
@@ -0,0 +1,144 @@
+package confirm
+
+import (
+	"context"
+	"time"
+
+	"github.com/lithdew/bytesutil"
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a tx given up by a permanent error or by exhausting retries,
+// parked to be inspected and requeued after the cause is fixed
+type DeadLetter struct {
+	Hash       string
+	PrevHashes []string // replaced by the hash
+	Err        string
+	Attempts   int // times ConfirmTx called
+	Retries    int // consecutive errors retried
+	Metadata   map[string]string
+	EnqueuedAt time.Time
+	FailedAt   time.Time
+}
+
+// park moves the entry to the dead-letter store
+func (c *Confirmer) park(e *entry, now int64, cause error) error {
+	b := bytesutil.AppendUint64LE([]byte{}, uint64(now))
+	b = appendString(b, truncate(cause.Error(), 1<<16-1))
+	b = append(b, e.encode()...)
+
+	if err := c.parked.Put(e.hash, b); err != nil {
+		return errors.Wrap(err, "err Put")
+	}
+
+	c.logger.Info("tx dead-lettered", LogKeyHash, e.hash, LogKeyAttempt, e.attempts, LogKeyErr, cause)
+	return nil
+}
+
+func decodeDeadLetter(hash string, value []byte) (*entry, DeadLetter, error) {
+	if len(value) < 8 {
+		return nil, DeadLetter{}, errors.Errorf("invalid dead letter, hash: %s", hash)
+	}
+
+	failedAt := int64(bytesutil.Uint64LE(value[0:8]))
+	msg, b, ok := readString(value[8:])
+	if !ok {
+		return nil, DeadLetter{}, errors.Errorf("invalid dead letter error, hash: %s", hash)
+	}
+
+	e, err := decodeEntry(hash, b)
+	if err != nil {
+		return nil, DeadLetter{}, err
+	}
+
+	return e, DeadLetter{
+		Hash:       e.hash,
+		PrevHashes: e.prevHashes,
+		Err:        msg,
+		Attempts:   int(e.attempts),
+		Retries:    int(e.retries),
+		Metadata:   e.metadata,
+		EnqueuedAt: time.Unix(0, e.enqueuedAt),
+		FailedAt:   time.Unix(0, failedAt),
+	}, nil
+}
+
+// DeadLetters iterates over the parked txs
+func (c *Confirmer) DeadLetters(fn func(DeadLetter) error) error {
+	return c.parked.Iterate(func(key string, value []byte) error {
+		_, d, err := decodeDeadLetter(key, value)
+		if err != nil {
+			return err
+		}
+		return fn(d)
+	})
+}
+
+// DeadLetter returns the parked tx, ErrDeadLetterNotFound unless parked
+func (c *Confirmer) DeadLetter(hash string) (DeadLetter, error) {
+	_, d, err := c.findDeadLetter(hash)
+	return d, err
+}
+
+// RequeueDeadLetter tracks the parked tx again, keeping its options and history.
+// The retries are reset, so that retried up to the max again.
+// Confirmed one only retries the handler.
+func (c *Confirmer) RequeueDeadLetter(ctx context.Context, hash string) error {
+	e, _, err := c.findDeadLetter(hash)
+	if err != nil {
+		return err
+	}
+
+	e.updatedAt = c.now()
+	e.notFoundAt = 0
+	e.retries, e.retryAt = 0, 0
+	e.handlerAttempts = 0
+
+	if err = c.slots.reserve(ctx, c.blockingEnqueue); err != nil {
+		return err
+	}
+	if err = c.admit(e, nil, TxQueued, nil); err != nil {
+		if err == errMerged {
+			// nothing to merge, the parked one is kept
+			return ErrAlreadyTracked
+		}
+		return err
+	}
+
+	if err = c.parked.Delete(hash); err != nil {
+		return errors.Wrap(err, "err Delete")
+	}
+
+	c.logger.Info("tx requeued", LogKeyHash, hash)
+	return nil
+}
+
+// PurgeDeadLetter removes the parked tx for good
+func (c *Confirmer) PurgeDeadLetter(hash string) error {
+	if _, _, err := c.findDeadLetter(hash); err != nil {
+		return err
+	}
+	if err := c.parked.Delete(hash); err != nil {
+		return errors.Wrap(err, "err Delete")
+	}
+	return nil
+}
+
+// findDeadLetter looks up the parked tx, ErrDeadLetterNotFound unless parked
+func (c *Confirmer) findDeadLetter(hash string) (*entry, DeadLetter, error) {
+	value, err := c.parked.Get(hash)
+	if err == ErrKeyNotFound {
+		return nil, DeadLetter{}, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, DeadLetter{}, errors.Wrap(err, "err Get")
+	}
+	return decodeDeadLetter(hash, value)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
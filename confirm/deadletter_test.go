@@ -0,0 +1,89 @@
+package confirm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+	"github.com/tak1827/transaction-confirmer/confirm/confirmtest"
+)
+
+func TestDeadLetter(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		chain = confirmtest.NewChain()
+		clock = confirmtest.NewClock(genesis)
+		store = confirm.NewMemoryStore()
+	)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithClock(clock), confirm.WithConfirmationInterval(0),
+		confirm.WithRetryBackoff(0), confirm.WithMaxRetries(1), confirm.WithStore(store),
+		confirm.WithAfterTxFailed(func(h string, err error) error {
+			return nil
+		}))
+
+	// failed permanently
+	err := c.EnqueueTx(ctx, "0x01", confirm.WithTxMetadata(map[string]string{"id": "1"}))
+	require.NoError(t, err)
+	chain.Mine(3)
+	chain.SetErrorRate(1, confirm.ErrTxFailed)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	chain.SetErrorRate(0, nil)
+
+	// exhausted retries
+	err = c.EnqueueTx(ctx, "0x02")
+	require.NoError(t, err)
+	chain.SetErrorRate(1, errors.New("unknown"))
+	_, err = c.DequeueTx(ctx)
+	require.Error(t, err)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	chain.SetErrorRate(0, nil)
+
+	require.Equal(t, 0, c.QueueLen())
+	require.Equal(t, 0, store.Len())
+
+	var hashes []string
+	err = c.DeadLetters(func(d confirm.DeadLetter) error {
+		hashes = append(hashes, d.Hash)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"0x01", "0x02"}, hashes)
+
+	d, err := c.DeadLetter("0x01")
+	require.NoError(t, err)
+	require.Equal(t, confirm.ErrTxFailed.Error(), d.Err)
+	require.Equal(t, 1, d.Attempts)
+	require.Equal(t, "1", d.Metadata["id"])
+
+	d, err = c.DeadLetter("0x02")
+	require.NoError(t, err)
+	require.Contains(t, d.Err, "retries exhausted")
+	require.Equal(t, 2, d.Attempts)
+	require.Equal(t, 2, d.Retries)
+
+	// replayed after fixed
+	err = c.RequeueDeadLetter(ctx, "0x01")
+	require.NoError(t, err)
+	require.Equal(t, 1, store.Len())
+	st, _ := c.Status("0x01")
+	require.Equal(t, confirm.TxQueued, st.State)
+
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+	st, _ = c.Status("0x01")
+	require.Equal(t, confirm.TxConfirmed, st.State)
+	require.Equal(t, 2, st.Attempts)
+
+	err = c.PurgeDeadLetter("0x02")
+	require.NoError(t, err)
+
+	_, err = c.DeadLetter("0x01")
+	require.ErrorIs(t, err, confirm.ErrDeadLetterNotFound)
+	err = c.PurgeDeadLetter("0x02")
+	require.ErrorIs(t, err, confirm.ErrDeadLetterNotFound)
+}
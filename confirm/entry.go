@@ -0,0 +1,280 @@
+package confirm
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/lithdew/bytesutil"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type entry struct {
+	hash        string
+	updatedAt   int64 // unix nano
+	notFoundAt  int64 // unix nano, first time the tx was not found after sent
+	resent      uint32
+	sentAt      int64 // unix nano, last time sent or replaced
+	replaced    uint32
+	prevHashes  []string // hashes replaced by the current one
+	blockNumber uint64   // block including the tx
+	blockHash   string
+	confirmedAt int64 // unix nano, watching for reorgs since
+
+	// per entry options, zero value falls back to the confirmer's
+	confirmationBlocks uint64
+	deadline           int64 // unix nano
+	metadata           map[string]string
+
+	enqueuedAt  int64 // unix nano, first time enqueued
+	attempts    uint32
+	checkedHead uint64 // latest head when checked last
+
+	spanContext trace.SpanContext // span enqueued the tx, parent of rechecks
+
+	retries uint32 // consecutive errors retried
+	retryAt int64  // unix nano, backed off until
+
+	handlerAttempts uint32 // AfterTxConfirmed failed
+	minedHash       string // confirmed, set while the handler is retried
+
+	gen uint64 // generation of the tracking, see index
+
+	staleKeys []string // replaced hashes left in the store, deleted by the next requeue
+}
+
+func newEntry(hash string, now int64, opts ...TxOpt) *entry {
+	e := entry{
+		hash:       hash,
+		updatedAt:  now,
+		sentAt:     now,
+		enqueuedAt: now,
+	}
+
+	for i := range opts {
+		opts[i].ApplyTx(&e)
+	}
+
+	return &e
+}
+
+// hashes returns all hashes sent for the entry, the latest first
+func (e *entry) hashes() []string {
+	hashes := make([]string, 0, len(e.prevHashes)+1)
+	hashes = append(hashes, e.hash)
+	for i := len(e.prevHashes) - 1; i >= 0; i-- {
+		hashes = append(hashes, e.prevHashes[i])
+	}
+	return hashes
+}
+
+// entryVersion is written first, so that the fields are changed under a new version
+const entryVersion = byte(1)
+
+// encode writes the version and the fields in order
+func (e *entry) encode() []byte {
+	b := []byte{entryVersion}
+	b = bytesutil.AppendUint64LE(b, uint64(e.updatedAt))
+	b = bytesutil.AppendUint64LE(b, uint64(e.notFoundAt))
+	b = bytesutil.AppendUint32LE(b, e.resent)
+	b = bytesutil.AppendUint64LE(b, uint64(e.sentAt))
+	b = bytesutil.AppendUint32LE(b, e.replaced)
+	b = bytesutil.AppendUint32LE(b, uint32(len(e.prevHashes)))
+	for _, h := range e.prevHashes {
+		b = appendString(b, h)
+	}
+	b = bytesutil.AppendUint64LE(b, e.blockNumber)
+	b = bytesutil.AppendUint64LE(b, uint64(e.confirmedAt))
+	b = appendString(b, e.blockHash)
+	b = bytesutil.AppendUint64LE(b, e.confirmationBlocks)
+	b = bytesutil.AppendUint64LE(b, uint64(e.deadline))
+	b = bytesutil.AppendUint32LE(b, uint32(len(e.metadata)))
+	for _, k := range sortedKeys(e.metadata) {
+		b = appendString(b, k)
+		b = appendString(b, e.metadata[k])
+	}
+	b = bytesutil.AppendUint64LE(b, uint64(e.enqueuedAt))
+	b = bytesutil.AppendUint32LE(b, e.attempts)
+	b = bytesutil.AppendUint64LE(b, e.checkedHead)
+	traceID, spanID := e.spanContext.TraceID(), e.spanContext.SpanID()
+	b = append(b, traceID[:]...)
+	b = append(b, spanID[:]...)
+	b = append(b, byte(e.spanContext.TraceFlags()))
+	b = bytesutil.AppendUint32LE(b, e.retries)
+	b = bytesutil.AppendUint64LE(b, uint64(e.retryAt))
+	b = bytesutil.AppendUint32LE(b, e.handlerAttempts)
+	b = appendString(b, e.minedHash)
+	b = bytesutil.AppendUint64LE(b, e.gen)
+	return b
+}
+
+// decodeEntry reads the value written by encode,
+// rejecting other versions and malformed values
+func decodeEntry(hash string, value []byte) (*entry, error) {
+	if len(value) == 0 || value[0] != entryVersion {
+		return nil, errors.Errorf("unsupported entry version, hash: %s", hash)
+	}
+
+	r := &reader{b: value[1:], ok: true}
+	e := entry{
+		hash:       hash,
+		updatedAt:  int64(r.uint64()),
+		notFoundAt: int64(r.uint64()),
+		resent:     r.uint32(),
+		sentAt:     int64(r.uint64()),
+		replaced:   r.uint32(),
+	}
+	for n := r.uint32(); n > 0 && r.ok; n-- {
+		e.prevHashes = append(e.prevHashes, r.string())
+	}
+	e.blockNumber = r.uint64()
+	e.confirmedAt = int64(r.uint64())
+	e.blockHash = r.string()
+	e.confirmationBlocks = r.uint64()
+	e.deadline = int64(r.uint64())
+	if n := r.uint32(); n > 0 && r.ok {
+		e.metadata = make(map[string]string)
+		for ; n > 0 && r.ok; n-- {
+			k := r.string()
+			e.metadata[k] = r.string()
+		}
+	}
+	e.enqueuedAt = int64(r.uint64())
+	e.attempts = r.uint32()
+	e.checkedHead = r.uint64()
+
+	// zero unless traced
+	var (
+		traceID trace.TraceID
+		spanID  trace.SpanID
+	)
+	copy(traceID[:], r.bytes(len(traceID)))
+	copy(spanID[:], r.bytes(len(spanID)))
+	flags := r.bytes(1)
+	if traceID.IsValid() {
+		e.spanContext = trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.TraceFlags(flags[0]),
+			Remote:     true,
+		})
+	}
+
+	e.retries = r.uint32()
+	e.retryAt = int64(r.uint64())
+	e.handlerAttempts = r.uint32()
+	e.minedHash = r.string()
+	e.gen = r.uint64()
+
+	if !r.ok || len(r.b) > 0 {
+		return nil, errors.Errorf("invalid entry value, hash: %s", hash)
+	}
+	return &e, nil
+}
+
+// reader reads the fields in order, reading zero values once run short
+type reader struct {
+	b  []byte
+	ok bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if !r.ok || len(r.b) < n {
+		r.ok = false
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) uint32() uint32 {
+	return bytesutil.Uint32LE(r.bytes(4))
+}
+
+func (r *reader) uint64() uint64 {
+	return bytesutil.Uint64LE(r.bytes(8))
+}
+
+func (r *reader) string() string {
+	if !r.ok {
+		return ""
+	}
+	s, b, ok := readString(r.b)
+	r.b, r.ok = b, ok
+	return s
+}
+
+// maxStringLen is the longest string persisted, prefixed by the uint16 length
+const maxStringLen = math.MaxUint16
+
+// validate rejects the entry which cannot be persisted as is
+func (e *entry) validate() error {
+	for k, v := range e.metadata {
+		if len(k) > maxStringLen || len(v) > maxStringLen {
+			return errors.Wrapf(ErrMetadataTooLarge, "max: %d, key: %d, value: %d", maxStringLen, len(k), len(v))
+		}
+	}
+	return nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = bytesutil.AppendUint16LE(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	if len(b) < 2 {
+		return "", b, false
+	}
+	l := int(bytesutil.Uint16LE(b))
+	if len(b) < 2+l {
+		return "", b, false
+	}
+	return string(b[2 : 2+l]), b[2+l:], true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// txMap retains the original txs for resending
+type txMap struct {
+	sync.Mutex
+
+	txs map[string]interface{}
+}
+
+func newTxMap() *txMap {
+	return &txMap{
+		txs: make(map[string]interface{}),
+	}
+}
+
+func (m *txMap) set(hash string, tx interface{}) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.txs[hash] = tx
+}
+
+func (m *txMap) get(hash string) (tx interface{}, ok bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	tx, ok = m.txs[hash]
+	return
+}
+
+func (m *txMap) delete(hash string) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.txs, hash)
+}
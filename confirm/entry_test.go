@@ -0,0 +1,62 @@
+package confirm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEntryEncode(t *testing.T) {
+	e := entry{
+		hash:        "0x02",
+		updatedAt:   2,
+		notFoundAt:  1,
+		resent:      1,
+		sentAt:      2,
+		replaced:    1,
+		prevHashes:  []string{"0x01"},
+		blockNumber: 1,
+		blockHash:   "0xa",
+		confirmedAt: 2,
+
+		confirmationBlocks: 30,
+		deadline:           3,
+		metadata:           map[string]string{"id": "1", "memo": ""},
+
+		enqueuedAt:  1,
+		attempts:    2,
+		checkedHead: 3,
+
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{2},
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		}),
+
+		retries: 1,
+		retryAt: 4,
+
+		handlerAttempts: 1,
+		minedHash:       "0x01",
+
+		gen: 5,
+	}
+
+	got, err := decodeEntry(e.hash, e.encode())
+	require.NoError(t, err)
+	require.Equal(t, &e, got)
+	require.Equal(t, []string{"0x02", "0x01"}, got.hashes())
+
+	// strictly decoded
+	value := e.encode()
+	_, err = decodeEntry(e.hash, append([]byte{entryVersion + 1}, value[1:]...))
+	require.Error(t, err)
+	_, err = decodeEntry(e.hash, value[:len(value)-1])
+	require.Error(t, err)
+	_, err = decodeEntry(e.hash, append(value, 0))
+	require.Error(t, err)
+	_, err = decodeEntry(e.hash, nil)
+	require.Error(t, err)
+}
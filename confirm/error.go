@@ -2,6 +2,7 @@ package confirm
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -10,4 +11,43 @@ var (
 	ErrTxConfirmPending           = errors.New("tx confirm pending")
 	ErrQueueIsEmpty               = errors.New("queue is empty")
 	ErrBeforeConfirmationInterval = errors.New("before confirmation interval")
+	ErrAlreadyStarted             = errors.New("already started")
+	ErrDeadLetterNotFound         = errors.New("dead letter not found")
+	ErrSubscriptionOverflow       = errors.New("subscription overflow")
+	ErrAlreadyTracked             = errors.New("already tracked")
+	ErrNotTracked                 = errors.New("not tracked")
+	ErrQueueFull                  = errors.New("queue is full")
+	ErrMetadataTooLarge           = errors.New("metadata too large")
+	ErrKeyNotFound                = errors.New("key not found")
+
+	errMerged = errors.New("merged into the tracked one")
 )
+
+// PendingError is ErrTxConfirmPending reporting the progress of the mined tx,
+// so that the next check is scheduled by the block time in the adaptive interval
+type PendingError struct {
+	BlockNumber   uint64 // including the tx
+	Confirmations uint64 // blocks on top of the including one
+}
+
+// ConfirmPending returns the PendingError of the tx mined at the block
+func ConfirmPending(blockNumber, head uint64) error {
+	p := &PendingError{BlockNumber: blockNumber}
+	if head > blockNumber {
+		p.Confirmations = head - blockNumber
+	}
+	return p
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("%s, block: %d, confirmations: %d", ErrTxConfirmPending, e.BlockNumber, e.Confirmations)
+}
+
+func (e *PendingError) Unwrap() error {
+	return ErrTxConfirmPending
+}
+
+// Head returns the latest block seen when checked
+func (e *PendingError) Head() uint64 {
+	return e.BlockNumber + e.Confirmations
+}
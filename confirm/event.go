@@ -0,0 +1,97 @@
+package confirm
+
+import (
+	"context"
+	"time"
+)
+
+// Event describes the tx notified to the event handlers
+type Event struct {
+	Type          EventType
+	Hash          string
+	PrevHash      string            // replaced by the hash, set only for the replaced
+	Tx            interface{}       // nil when enqueued by hash or resumed from the store
+	Metadata      map[string]string // attached by WithTxMetadata
+	BlockNumber   uint64            // zero unless the client reports
+	Confirmations uint64            // blocks on top of the including one, at least the required
+	GasUsed       uint64            // zero unless the client is ReceiptReporter
+	Attempts      int               // times ConfirmTx called
+	Latency       time.Duration     // since first enqueued
+	Err           error             // set only for errors
+}
+
+type (
+	EventHandler    func(context.Context, Event) error
+	ErrEventHandler func(context.Context, Event)
+)
+
+// HashEventHandler adapts the handler taking only the hash
+func HashEventHandler(f func(string) error) EventHandler {
+	return func(ctx context.Context, ev Event) error {
+		return f(ev.Hash)
+	}
+}
+
+// ErrHashEventHandler adapts the error handler taking only the hash
+func ErrHashEventHandler(f func(string, error)) ErrEventHandler {
+	return func(ctx context.Context, ev Event) {
+		f(ev.Hash, ev.Err)
+	}
+}
+
+// Receipt is the result of the tx reported by ReceiptReporter
+type Receipt struct {
+	BlockNumber uint64
+	BlockHash   string
+	GasUsed     uint64
+}
+
+// event builds the event of the entry, the hash of which may be a replaced one
+func (c *Confirmer) event(typ EventType, e *entry, hash string, now int64) Event {
+	tx, _ := c.txs.get(hash)
+	return Event{
+		Type:        typ,
+		Hash:        hash,
+		Tx:          tx,
+		Metadata:    e.metadata,
+		BlockNumber: e.blockNumber,
+		Attempts:    int(e.attempts),
+		Latency:     time.Duration(now - e.enqueuedAt),
+	}
+}
+
+// confirmedEvent fills the event with the receipt, if the client reports.
+// Failed to get it is only logged, not to block confirming.
+func (c *Confirmer) confirmedEvent(ctx context.Context, e *entry, hash string, now int64, head uint64) Event {
+	ev := c.event(EventConfirmed, e, hash, now)
+	ev.Confirmations = c.confirmationBlocksOf(e)
+
+	if r, ok := c.client.(ReceiptReporter); ok {
+		receipt, err := r.TxReceipt(ctx, hash)
+		if err != nil {
+			c.logger.Error("failed to get receipt", LogKeyHash, hash, LogKeyErr, err)
+		} else {
+			ev.BlockNumber = receipt.BlockNumber
+			ev.GasUsed = receipt.GasUsed
+		}
+	}
+
+	if ev.BlockNumber > 0 && head >= ev.BlockNumber && head-ev.BlockNumber > ev.Confirmations {
+		ev.Confirmations = head - ev.BlockNumber
+	}
+
+	return ev
+}
+
+// errEvent builds the event of the error from the status, as the entry may be gone
+func (c *Confirmer) errEvent(hash string, err error) Event {
+	ev := Event{Type: EventError, Hash: hash, Err: err}
+	if st, ok := c.statuses.get(hash); ok {
+		ev.Metadata = st.Metadata
+		ev.BlockNumber = st.BlockNumber
+		ev.Attempts = st.Attempts
+		ev.Latency = c.clock.Now().Sub(st.EnqueuedAt)
+	}
+	ev.Tx, _ = c.txs.get(hash)
+	return ev
+}
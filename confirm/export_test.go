@@ -0,0 +1,16 @@
+package confirm
+
+import "time"
+
+// exported for the tests in confirm_test, which import confirmtest
+
+func (c *Confirmer) Resume() error {
+	return c.resume()
+}
+
+// PutEntry persists the entry of the hash replacing the previous ones, as if crashed
+func PutEntry(s Store, hash string, at time.Time, prevHashes ...string) error {
+	e := newEntry(hash, at.UnixNano())
+	e.prevHashes = prevHashes
+	return s.Put(hash, e.encode())
+}
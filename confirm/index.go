@@ -0,0 +1,207 @@
+package confirm
+
+import (
+	"sync"
+	"time"
+)
+
+// Duplicate is the policy when the hash tracked already is enqueued
+type Duplicate int
+
+const (
+	DuplicateReject Duplicate = iota // returns ErrAlreadyTracked
+	DuplicateMerge                   // applies the tx options to the tracked one
+)
+
+func (d Duplicate) Apply(c *Confirmer) {
+	c.duplicate = d
+}
+
+// WithDuplicate sets the policy when the hash tracked already is enqueued,
+// DuplicateReject by default
+func WithDuplicate(d Duplicate) Duplicate {
+	return d
+}
+
+// tracking is the entry tracked under the generation. Copies of the entry
+// left in the queue after removed are told by the generation, and dropped.
+type tracking struct {
+	gen    uint64
+	key    string   // the current hash, the key in the store
+	hashes []string // including replaced ones
+	merged []TxOpt  // applied when dequeued next
+}
+
+// index keeps every hash tracked, including ones being checked by workers
+type index struct {
+	sync.Mutex
+
+	hashes map[string]*tracking
+	gen    uint64
+}
+
+func newIndex() *index {
+	return &index{
+		hashes: make(map[string]*tracking),
+		// not to collide with the generations resumed from the store
+		gen: uint64(time.Now().UnixNano()),
+	}
+}
+
+// track reserves the entry, assigning a new generation.
+// The tracking is returned if the hash is tracked already.
+func (i *index) track(e *entry) (*tracking, bool) {
+	i.Lock()
+	defer i.Unlock()
+
+	if t, ok := i.hashes[e.hash]; ok {
+		return t, false
+	}
+
+	i.gen++
+	e.gen = i.gen
+	i.add(e)
+	return nil, true
+}
+
+// resume tracks the entry under its own generation, unless any of its hashes is tracked.
+// The key of the tracking is returned otherwise, telling the entry superseded by a replacement.
+func (i *index) resume(e *entry) (string, bool) {
+	i.Lock()
+	defer i.Unlock()
+
+	for _, h := range e.hashes() {
+		if t, ok := i.hashes[h]; ok {
+			return t.key, false
+		}
+	}
+
+	i.add(e)
+	return "", true
+}
+
+func (i *index) add(e *entry) {
+	t := &tracking{gen: e.gen, key: e.hash, hashes: e.hashes()}
+	for _, h := range t.hashes {
+		i.hashes[h] = t
+	}
+}
+
+// merge adds the options to the tracked hash
+func (i *index) merge(hash string, opts []TxOpt) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[hash]
+	if !ok {
+		return false
+	}
+	t.merged = append(t.merged, opts...)
+	return true
+}
+
+// current reports whether the entry is the one tracked,
+// applying the options merged meanwhile
+func (i *index) current(e *entry) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[e.hash]
+	if !ok || t.gen != e.gen {
+		return false
+	}
+
+	for _, o := range t.merged {
+		o.ApplyTx(e)
+	}
+	t.merged = nil
+	return true
+}
+
+func (i *index) replaced(e *entry) {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[e.prevHashes[len(e.prevHashes)-1]]
+	if !ok || t.gen != e.gen {
+		return
+	}
+	t.key = e.hash
+	t.hashes = append(t.hashes, e.hash)
+	i.hashes[e.hash] = t
+}
+
+// remove stops tracking the entry, if still tracked
+func (i *index) remove(e *entry) {
+	i.Lock()
+	defer i.Unlock()
+
+	if t, ok := i.hashes[e.hash]; ok && t.gen == e.gen {
+		i.delete(t)
+	}
+}
+
+// removeIf stops tracking the entry, calling the fn before tracked again.
+// ErrNotTracked is returned if removed or tracked again by another entry.
+func (i *index) removeIf(e *entry, fn func() error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[e.hash]
+	if !ok || t.gen != e.gen {
+		return ErrNotTracked
+	}
+	i.delete(t)
+	return fn()
+}
+
+// removeHash stops tracking the entry of the hash, calling the fn with the key in the store
+// before tracked again. ErrNotTracked is returned unless tracked.
+func (i *index) removeHash(hash string, fn func(key string) error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[hash]
+	if !ok {
+		return ErrNotTracked
+	}
+	i.delete(t)
+	return fn(t.key)
+}
+
+func (i *index) delete(t *tracking) {
+	for _, h := range t.hashes {
+		if i.hashes[h] == t {
+			delete(i.hashes, h)
+		}
+	}
+}
+
+// ifTracked calls the fn while the entry is tracked,
+// so that not removed meanwhile. ErrNotTracked is returned if removed.
+func (i *index) ifTracked(e *entry, fn func() error) error {
+	i.Lock()
+	defer i.Unlock()
+
+	if t, ok := i.hashes[e.hash]; !ok || t.gen != e.gen {
+		return ErrNotTracked
+	}
+	return fn()
+}
+
+// tracks reports whether the entry is the one tracked
+func (i *index) tracks(e *entry) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	t, ok := i.hashes[e.hash]
+	return ok && t.gen == e.gen
+}
+
+func (i *index) has(hash string) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	_, ok := i.hashes[hash]
+	return ok
+}
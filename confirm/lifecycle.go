@@ -0,0 +1,264 @@
+package confirm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lifecycle guards workers from being started or shut down twice
+type lifecycle struct {
+	sync.Mutex
+
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when every worker of the run exits
+	running bool
+}
+
+// Start resumes the persisted entries and starts workers.
+// Workers stop when the ctx is canceled or Shutdown is called.
+// Restarting after shut down is allowed.
+func (c *Confirmer) Start(ctx context.Context) error {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+
+	if c.lifecycle.running {
+		return ErrAlreadyStarted
+	}
+
+	if err := c.resume(); err != nil {
+		return errors.Wrap(err, "err resume")
+	}
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	if c.headDriven {
+		s, ok := c.client.(HeadSubscriber)
+		if !ok {
+			cancel()
+			return errors.New("client is not HeadSubscriber")
+		}
+
+		heads, err := s.SubscribeHeads(ctx)
+		if err != nil {
+			cancel()
+			return errors.Wrap(err, "err SubscribeHeads")
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.followHeads(ctx, s, heads)
+		}()
+	}
+
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			c.work(ctx, id)
+		}(i + 1)
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	c.lifecycle.cancel = cancel
+	c.lifecycle.done = done
+	c.lifecycle.running = true
+
+	c.logger.Info("confirmer started", LogKeyWorkers, c.workers, LogKeyQueueLen, c.QueueLen())
+	return nil
+}
+
+// Shutdown stops workers and waits for in-flight confirmations to finish.
+// Due entries are checked once more before returning if drain on shutdown is set.
+// The txs left unconfirmed are returned, which are resumed by the next Start
+// as long as persisted in the store.
+func (c *Confirmer) Shutdown(ctx context.Context) ([]TxStatus, error) {
+	c.lifecycle.Lock()
+	defer c.lifecycle.Unlock()
+
+	if c.lifecycle.running {
+		c.lifecycle.cancel()
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "err waiting workers")
+		case <-c.lifecycle.done:
+		}
+
+		c.lifecycle.running = false
+		atomic.StoreUint64(&c.head, 0)
+		c.queue.flush(0, c.now())
+
+		if c.drainOnShutdown {
+			c.drain(ctx)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "err draining")
+	}
+
+	var remaining []TxStatus
+	c.Pending(func(st TxStatus) error {
+		remaining = append(remaining, st)
+		return nil
+	})
+
+	c.logger.Info("confirmer shut down", LogKeyRemaining, len(remaining))
+
+	return remaining, nil
+}
+
+// Close stops workers, waiting for them without time limit.
+//
+// Deprecated: Use Shutdown instead.
+func (c *Confirmer) Close(cancel context.CancelFunc) {
+	cancel()
+	c.Shutdown(context.Background())
+}
+
+// work ticks at most every worker interval while entries are due,
+// otherwise sleeps until the earliest one gets due or an earlier one is scheduled
+func (c *Confirmer) work(ctx context.Context, id int) {
+	c.logger.Debug("worker started", LogKeyWorker, id)
+
+	var (
+		interval    = c.workerInterval
+		timer, stop = c.clock.NewTimer(interval)
+		wake        <-chan struct{}
+	)
+	defer func() { stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Debug("worker stopped", LogKeyWorker, id)
+			return
+		case <-timer:
+		case <-wake:
+			stop()
+		}
+
+		tctx, cancel := c.withTimeout(context.Background())
+		n := c.tick(tctx)
+		cancel()
+
+		timer, wake = nil, nil
+		if n > 0 {
+			timer, stop = c.clock.NewTimer(interval)
+			continue
+		}
+
+		at, ok, ch := c.queue.next()
+		wake = ch
+		if !ok {
+			continue
+		}
+		wait := time.Unix(0, at).Sub(c.clock.Now())
+		if wait < interval {
+			wait = interval
+		}
+		timer, stop = c.clock.NewTimer(wait)
+	}
+}
+
+// tick confirms the earliest due entry, or the batch of due entries by BatchClient.
+// Returns how many entries are dequeued at most.
+func (c *Confirmer) tick(ctx context.Context) int {
+	c.metrics.QueueLen(c.QueueLen())
+
+	if !c.queue.due(c.now()) {
+		return 0
+	}
+
+	c.metrics.InFlight(1)
+	defer c.metrics.InFlight(-1)
+
+	if c.batch != nil {
+		for hash, err := range c.DequeueTxs(ctx) {
+			c.handleErr(ctx, hash, err)
+		}
+		return c.batchSize
+	}
+
+	if hash, err := c.DequeueTx(ctx); err != nil {
+		c.handleErr(ctx, hash, err)
+	}
+	return 1
+}
+
+func (c *Confirmer) handleErr(ctx context.Context, hash string, err error) {
+	c.logger.Error("tx error", LogKeyHash, hash, LogKeyErr, err)
+	ev := c.errEvent(hash, err)
+	c.publish(ctx, ev)
+	c.ErrHandler(ctx, ev)
+}
+
+// drain checks due entries once, confirming them
+func (c *Confirmer) drain(ctx context.Context) {
+	for n := c.QueueLen(); n > 0 && ctx.Err() == nil && c.queue.due(c.now()); {
+		tctx, cancel := c.withTimeout(ctx)
+		n -= c.tick(tctx)
+		cancel()
+	}
+}
+
+// followHeads keeps the latest head. Falls back to polling by the confirmation interval
+// while resubscribing after the subscription ends.
+func (c *Confirmer) followHeads(ctx context.Context, s HeadSubscriber, heads <-chan uint64) {
+	interval := c.confirmationInterval
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case head, ok := <-heads:
+			if ok {
+				now := c.now()
+				atomic.StoreUint64(&c.head, head)
+				c.blocks.observe(head, now)
+				c.queue.flush(head, now)
+				continue
+			}
+		}
+
+		// the subscription ended
+		atomic.StoreUint64(&c.head, 0)
+		c.queue.flush(0, c.now())
+
+		for {
+			timer, stop := c.clock.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				stop()
+				return
+			case <-timer:
+			}
+
+			var err error
+			if heads, err = s.SubscribeHeads(ctx); err == nil {
+				break
+			}
+		}
+	}
+}
+
+func (c *Confirmer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.timeout)
+}
@@ -0,0 +1,432 @@
+package confirm_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+	"github.com/tak1827/transaction-confirmer/confirm/confirmtest"
+)
+
+// await advances the clock by the step whenever a worker waits for it, until received from the ch
+func await[T any](clock *confirmtest.Clock, step time.Duration, ch <-chan T) T {
+	for {
+		select {
+		case v := <-ch:
+			return v
+		case <-clock.Waiting(1):
+			clock.Advance(step)
+		}
+	}
+}
+
+type safeMap struct {
+	sync.Mutex
+	unsent      map[string]struct{}
+	unconfirmed map[string]struct{}
+}
+
+func (s *safeMap) deleteSent(hash string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.unsent, hash)
+}
+
+func (s *safeMap) deleteConfirmed(hash string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.unconfirmed, hash)
+}
+
+func TestSendTxDequeueTx(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		clock       = confirmtest.NewClock(genesis)
+		txs         = []string{
+			"0x01",
+			"0x02",
+			"0x03",
+			"0x04",
+			"0x05",
+		}
+		checker = safeMap{
+			unsent:      make(map[string]struct{}, len(txs)),
+			unconfirmed: make(map[string]struct{}, len(txs)),
+		}
+		sent = func(h string) error {
+			checker.deleteSent(h)
+			return nil
+		}
+		done      = make(chan struct{}, len(txs))
+		confirmed = func(h string) error {
+			checker.deleteConfirmed(h)
+			done <- struct{}{}
+			return nil
+		}
+	)
+
+	c := confirm.NewConfirmer(&confirm.MockClient{}, 5, confirm.WithWorkers(2), confirm.WithTimeout(3), confirm.WithClock(clock),
+		confirm.WithAfterTxSent(sent), confirm.WithAfterTxConfirmed(confirmed))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	for _, tx := range txs {
+		checker.unsent[tx] = struct{}{}
+		checker.unconfirmed[tx] = struct{}{}
+
+		c.EnqueueTx(context.Background(), tx)
+	}
+
+	for range txs {
+		await(clock, 100*time.Millisecond, done)
+	}
+
+	c.Close(cancel)
+
+	require.Equal(t, len(checker.unsent), 0)
+	require.Equal(t, len(checker.unconfirmed), 0)
+}
+
+func TestErrHandle(t *testing.T) {
+	var (
+		ctx, cancel  = context.WithCancel(context.Background())
+		chain        = confirmtest.NewChain()
+		clock        = confirmtest.NewClock(genesis)
+		expectedHash = "0x01"
+		expectedErr  = confirm.ErrTxFailed
+		closing      = make(chan struct{})
+		errHandler   = func(h string, err error) {
+			defer close(closing)
+
+			if !errors.Is(err, expectedErr) {
+				panic("unexpected error")
+			}
+
+			if h != expectedHash {
+				panic("unexpected hash")
+			}
+		}
+	)
+
+	// reverted when mined
+	chain.Fail(expectedHash)
+
+	c := confirm.NewConfirmer(chain, 5, confirm.WithWorkers(1), confirm.WithClock(clock), confirm.WithErrHandler(errHandler))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	c.EnqueueTx(context.Background(), expectedHash)
+	chain.Mine(1)
+
+	await(clock, 100*time.Millisecond, closing)
+
+	c.Close(cancel)
+}
+
+func TestResume(t *testing.T) {
+	var (
+		ctx, cancel  = context.WithCancel(context.Background())
+		clock        = confirmtest.NewClock(genesis)
+		expectedHash = "0x01"
+		s            = confirm.NewMemoryStore()
+		sent         = func(h string) error {
+			// the hash should be persisted before notified
+			if s.Len() != 1 {
+				panic("hash is not persisted")
+			}
+			return nil
+		}
+		confirmed = make(chan string, 1)
+	)
+
+	// enqueue without starting, as if the process crashed
+	c1 := confirm.NewConfirmer(&confirm.MockClient{}, 5, confirm.WithStore(s), confirm.WithClock(clock), confirm.WithAfterTxSent(sent))
+	err := c1.EnqueueTx(context.Background(), expectedHash)
+	require.NoError(t, err)
+
+	c2 := confirm.NewConfirmer(&confirm.MockClient{}, 5, confirm.WithWorkers(1), confirm.WithStore(s), confirm.WithClock(clock),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
+	err = c2.Start(ctx)
+	require.NoError(t, err)
+
+	require.Equal(t, expectedHash, await(clock, 100*time.Millisecond, confirmed))
+
+	c2.Close(cancel)
+
+	require.Equal(t, 0, s.Len())
+}
+
+// droppedClient does not find the tx until resent
+type droppedClient struct {
+	sent uint32
+}
+
+func (c *droppedClient) SendTx(ctx context.Context, tx interface{}) (string, error) {
+	atomic.AddUint32(&c.sent, 1)
+	return tx.(string), nil
+}
+
+func (c *droppedClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	if atomic.LoadUint32(&c.sent) < 2 {
+		return confirm.ErrTxNotFound
+	}
+	return nil
+}
+
+func TestResend(t *testing.T) {
+	var (
+		ctx, cancel  = context.WithCancel(context.Background())
+		clock        = confirmtest.NewClock(genesis)
+		expectedHash = "0x01"
+		client       = &droppedClient{}
+		resent       = make(chan int, 1)
+		confirmed    = make(chan string, 1)
+	)
+
+	c := confirm.NewConfirmer(client, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithResendWindow(1), confirm.WithMaxResends(1),
+		confirm.WithAfterTxResent(func(h string, attempts int) error {
+			resent <- attempts
+			return nil
+		}),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), expectedHash)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, await(clock, 100*time.Millisecond, resent))
+	require.Equal(t, expectedHash, await(clock, 100*time.Millisecond, confirmed))
+
+	c.Close(cancel)
+}
+
+// replacingClient mines the original tx after replaced
+type replacingClient struct {
+	replaced uint32
+}
+
+func (c *replacingClient) SendTx(ctx context.Context, tx interface{}) (string, error) {
+	return tx.(string), nil
+}
+
+func (c *replacingClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	if atomic.LoadUint32(&c.replaced) == 0 || hash != "0x01" {
+		return confirm.ErrTxNotFound
+	}
+	return nil
+}
+
+func (c *replacingClient) ReplaceTx(ctx context.Context, tx interface{}) (interface{}, error) {
+	atomic.AddUint32(&c.replaced, 1)
+	return tx.(string) + "ff", nil
+}
+
+func TestReplace(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		clock       = confirmtest.NewClock(genesis)
+		s           = confirm.NewMemoryStore()
+		replaced    = make(chan [2]string, 1)
+		confirmed   = make(chan string, 1)
+	)
+
+	c := confirm.NewConfirmer(&replacingClient{}, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithReplaceAfter(1), confirm.WithStore(s),
+		confirm.WithAfterTxReplaced(func(oldHash, newHash string) error {
+			replaced <- [2]string{oldHash, newHash}
+			return nil
+		}),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), "0x01")
+	require.NoError(t, err)
+
+	require.Equal(t, [2]string{"0x01", "0x01ff"}, await(clock, 100*time.Millisecond, replaced))
+	// the original one is mined
+	require.Equal(t, "0x01", await(clock, 100*time.Millisecond, confirmed))
+
+	c.Close(cancel)
+
+	require.Equal(t, 0, s.Len())
+}
+
+// reorgClient moves the tx to another block after first reported
+type reorgClient struct {
+	confirm.MockClient
+	reported uint32
+}
+
+func (c *reorgClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	return nil
+}
+
+func (c *reorgClient) TxBlock(ctx context.Context, hash string) (uint64, string, error) {
+	if atomic.AddUint32(&c.reported, 1) == 1 {
+		return 1, "0xa", nil
+	}
+	return 2, "0xb", nil
+}
+
+func TestReorg(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		clock       = confirmtest.NewClock(genesis)
+		s           = confirm.NewMemoryStore()
+		events      = make(chan string, 3)
+	)
+
+	c := confirm.NewConfirmer(&reorgClient{}, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationInterval(0), confirm.WithReorgWatchWindow(1), confirm.WithStore(s),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			events <- "confirmed"
+			return nil
+		}),
+		confirm.WithAfterTxReorged(func(h string) error {
+			events <- "reorged"
+			return nil
+		}))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), "0x01")
+	require.NoError(t, err)
+
+	require.Equal(t, "confirmed", await(clock, 10*time.Millisecond, events))
+	require.Equal(t, "reorged", await(clock, 10*time.Millisecond, events))
+	require.Equal(t, "confirmed", await(clock, 10*time.Millisecond, events))
+
+	c.Close(cancel)
+
+	// removed after the watch window
+	clock.Advance(time.Second)
+	_, err = c.DequeueTx(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, s.Len())
+}
+
+// headClient includes the tx in the block 1
+type headClient struct {
+	confirm.MockClient
+	heads  chan uint64
+	checks chan uint64
+	head   uint64
+}
+
+func (c *headClient) SubscribeHeads(ctx context.Context) (<-chan uint64, error) {
+	return c.heads, nil
+}
+
+func (c *headClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	head := atomic.LoadUint64(&c.head)
+	c.checks <- head
+	if 1+confirmationBlocks > head {
+		return confirm.ErrTxConfirmPending
+	}
+	return nil
+}
+
+func (c *headClient) TxBlock(ctx context.Context, hash string) (uint64, string, error) {
+	return 1, "0xa", nil
+}
+
+func (c *headClient) mine(head uint64) {
+	atomic.StoreUint64(&c.head, head)
+	c.heads <- head
+}
+
+func TestHeadDriven(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		clock       = confirmtest.NewClock(genesis)
+		client      = &headClient{heads: make(chan uint64), checks: make(chan uint64, 4)}
+		confirmed   = make(chan string, 1)
+	)
+
+	c := confirm.NewConfirmer(client, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithHeadDriven(true), confirm.WithConfirmationBlock(3),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			confirmed <- h
+			return nil
+		}))
+	err := c.Start(ctx)
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), "0x01")
+	require.NoError(t, err)
+
+	client.mine(1)
+	require.Equal(t, uint64(1), await(clock, time.Millisecond, client.checks))
+
+	// the depth is not satisfied, so never checked until the head 4
+	client.mine(2)
+	client.mine(3)
+	client.mine(4)
+	require.Equal(t, uint64(4), await(clock, time.Millisecond, client.checks))
+	require.Equal(t, "0x01", await(clock, time.Millisecond, confirmed))
+	require.Len(t, client.checks, 0)
+
+	c.Close(cancel)
+}
+
+// pendingClient keeps txs pending for the first checks
+type pendingClient struct {
+	confirm.MockClient
+	pending int32
+	calls   int32
+}
+
+func (c *pendingClient) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	if atomic.AddInt32(&c.calls, 1) <= c.pending {
+		return confirm.ErrTxConfirmPending
+	}
+	return nil
+}
+
+func TestSubSecondInterval(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		clock     = confirmtest.NewClock(genesis)
+		client    = &pendingClient{pending: 3}
+		confirmed = make(chan time.Duration, 1)
+	)
+
+	c := confirm.NewConfirmer(client, 5, confirm.WithWorkers(1), confirm.WithClock(clock),
+		confirm.WithConfirmationIntervalDuration(50*time.Millisecond),
+		confirm.WithWorkerIntervalDuration(time.Millisecond),
+		confirm.WithTimeoutDuration(500*time.Millisecond),
+		confirm.WithAfterTxConfirmedEvent(func(ctx context.Context, ev confirm.Event) error {
+			confirmed <- ev.Latency
+			return nil
+		}))
+
+	err := c.Start(ctx)
+	require.NoError(t, err)
+	defer c.Shutdown(ctx)
+
+	err = c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+
+	// checked every interval, not every second
+	require.Equal(t, 200*time.Millisecond, await(clock, time.Millisecond, confirmed))
+	require.Equal(t, int32(4), atomic.LoadInt32(&client.calls))
+}
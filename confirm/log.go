@@ -0,0 +1,32 @@
+package confirm
+
+// Logger receives structured events of the confirmer.
+// Keyvals are alternating keys and values, like "hash", "0x01", "attempt", 1.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+const (
+	LogKeyHash      = "hash"
+	LogKeyAttempt   = "attempt"
+	LogKeyLatency   = "latency"
+	LogKeyErr       = "err"
+	LogKeyWorker    = "worker"
+	LogKeyWorkers   = "workers"
+	LogKeyNewHash   = "new_hash"
+	LogKeyBlock     = "block"
+	LogKeyQueueLen  = "queue_len"
+	LogKeyRemaining = "remaining"
+)
+
+var _ Logger = (*nopLogger)(nil)
+
+type nopLogger struct{}
+
+func (l nopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+func (l nopLogger) Info(msg string, keyvals ...interface{}) {}
+
+func (l nopLogger) Error(msg string, keyvals ...interface{}) {}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+type client struct{}
+
+func (c *client) SendTx(ctx context.Context, tx interface{}) (string, error) {
+	return tx.(string), nil
+}
+
+func (c *client) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	return nil
+}
+
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func confirmOne(t *testing.T, l confirm.Logger) {
+	confirmed := make(chan struct{})
+
+	c := confirm.NewConfirmer(&client{}, 1, confirm.WithWorkers(1), confirm.WithConfirmationInterval(0), confirm.WithLogger(l),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			close(confirmed)
+			return nil
+		}))
+
+	err := c.Start(context.Background())
+	require.NoError(t, err)
+
+	err = c.EnqueueTx(context.Background(), "0x01")
+	require.NoError(t, err)
+
+	<-confirmed
+
+	_, err = c.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
+func TestZerolog(t *testing.T) {
+	var buf syncBuffer
+
+	confirmOne(t, NewZerolog(zerolog.New(&buf)))
+
+	out := buf.String()
+	require.Contains(t, out, `"message":"tx confirmed"`)
+	require.Contains(t, out, `"hash":"0x01"`)
+	require.Contains(t, out, `"attempt":1`)
+	require.Contains(t, out, `"message":"worker stopped"`)
+}
+
+func TestSlog(t *testing.T) {
+	var buf syncBuffer
+
+	confirmOne(t, NewSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	out := buf.String()
+	require.Contains(t, out, `"msg":"tx confirmed"`)
+	require.Contains(t, out, `"hash":"0x01"`)
+	require.Contains(t, out, `"attempt":1`)
+	require.Contains(t, out, `"msg":"worker stopped"`)
+}
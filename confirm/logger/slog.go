@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"log/slog"
+
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+var _ confirm.Logger = (*Slog)(nil)
+
+type Slog struct {
+	l *slog.Logger
+}
+
+func NewSlog(l *slog.Logger) *Slog {
+	return &Slog{l: l}
+}
+
+func (s *Slog) Debug(msg string, keyvals ...interface{}) {
+	s.l.Debug(msg, keyvals...)
+}
+
+func (s *Slog) Info(msg string, keyvals ...interface{}) {
+	s.l.Info(msg, keyvals...)
+}
+
+func (s *Slog) Error(msg string, keyvals ...interface{}) {
+	s.l.Error(msg, keyvals...)
+}
@@ -0,0 +1,28 @@
+package logger
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+var _ confirm.Logger = (*Zerolog)(nil)
+
+type Zerolog struct {
+	l zerolog.Logger
+}
+
+func NewZerolog(l zerolog.Logger) *Zerolog {
+	return &Zerolog{l: l}
+}
+
+func (z *Zerolog) Debug(msg string, keyvals ...interface{}) {
+	z.l.Debug().Fields(keyvals).Msg(msg)
+}
+
+func (z *Zerolog) Info(msg string, keyvals ...interface{}) {
+	z.l.Info().Fields(keyvals).Msg(msg)
+}
+
+func (z *Zerolog) Error(msg string, keyvals ...interface{}) {
+	z.l.Error().Fields(keyvals).Msg(msg)
+}
@@ -0,0 +1,40 @@
+package confirm
+
+import (
+	"time"
+)
+
+// Metrics observes the confirmer pipeline
+type Metrics interface {
+	TxSent()
+	TxConfirmed(latency time.Duration) // since first enqueued
+	TxFailed()
+	TxNotFound() // rechecked, but not found
+	TxPending()  // rechecked, but not deep enough
+	HandlerError()
+	QueueLen(n int)
+	InFlight(delta int) // workers confirming now
+	ConfirmTxDuration(d time.Duration)
+}
+
+var _ Metrics = (*nopMetrics)(nil)
+
+type nopMetrics struct{}
+
+func (m nopMetrics) TxSent() {}
+
+func (m nopMetrics) TxConfirmed(latency time.Duration) {}
+
+func (m nopMetrics) TxFailed() {}
+
+func (m nopMetrics) TxNotFound() {}
+
+func (m nopMetrics) TxPending() {}
+
+func (m nopMetrics) HandlerError() {}
+
+func (m nopMetrics) QueueLen(n int) {}
+
+func (m nopMetrics) InFlight(delta int) {}
+
+func (m nopMetrics) ConfirmTxDuration(d time.Duration) {}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+const (
+	Namespace = "confirmer"
+
+	// LabelName distinguishes confirmers sharing the registry
+	LabelName = "name"
+)
+
+var _ confirm.Metrics = (*Prometheus)(nil)
+
+type Prometheus struct {
+	sent            prometheus.Counter
+	confirmed       prometheus.Counter
+	failed          prometheus.Counter
+	notFound        prometheus.Counter
+	pending         prometheus.Counter
+	handlerErrors   prometheus.Counter
+	queueLen        prometheus.Gauge
+	inFlight        prometheus.Gauge
+	latency         prometheus.Histogram
+	confirmDuration prometheus.Histogram
+}
+
+// NewPrometheus registers the collectors to the registerer.
+// The name is attached as a label unless empty.
+func NewPrometheus(reg prometheus.Registerer, name string) (*Prometheus, error) {
+	var labels prometheus.Labels
+	if name != "" {
+		labels = prometheus.Labels{LabelName: name}
+	}
+
+	counter := func(n, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Namespace: Namespace, Name: n, Help: help, ConstLabels: labels})
+	}
+	gauge := func(n, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Namespace: Namespace, Name: n, Help: help, ConstLabels: labels})
+	}
+	histogram := func(n, help string, buckets []float64) prometheus.Histogram {
+		return prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: Namespace, Name: n, Help: help, ConstLabels: labels, Buckets: buckets})
+	}
+
+	m := Prometheus{
+		sent:            counter("txs_sent_total", "Txs sent by the confirmer."),
+		confirmed:       counter("txs_confirmed_total", "Txs confirmed."),
+		failed:          counter("txs_failed_total", "Txs failed on chain or given up by an error."),
+		notFound:        counter("rechecks_not_found_total", "Rechecks which did not find the tx."),
+		pending:         counter("rechecks_pending_total", "Rechecks which found the tx not deep enough."),
+		handlerErrors:   counter("handler_errors_total", "Errors returned by the handlers."),
+		queueLen:        gauge("queue_length", "Entries in the queue."),
+		inFlight:        gauge("workers_in_flight", "Workers confirming now."),
+		latency:         histogram("confirm_latency_seconds", "Time from sent to confirmed.", prometheus.ExponentialBuckets(1, 2, 12)),
+		confirmDuration: histogram("confirm_tx_duration_seconds", "Duration of ConfirmTx calls.", prometheus.DefBuckets),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.sent, m.confirmed, m.failed, m.notFound, m.pending, m.handlerErrors,
+		m.queueLen, m.inFlight, m.latency, m.confirmDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "err Register")
+		}
+	}
+
+	return &m, nil
+}
+
+func (m *Prometheus) TxSent() {
+	m.sent.Inc()
+}
+
+func (m *Prometheus) TxConfirmed(latency time.Duration) {
+	m.confirmed.Inc()
+	m.latency.Observe(latency.Seconds())
+}
+
+func (m *Prometheus) TxFailed() {
+	m.failed.Inc()
+}
+
+func (m *Prometheus) TxNotFound() {
+	m.notFound.Inc()
+}
+
+func (m *Prometheus) TxPending() {
+	m.pending.Inc()
+}
+
+func (m *Prometheus) HandlerError() {
+	m.handlerErrors.Inc()
+}
+
+func (m *Prometheus) QueueLen(n int) {
+	m.queueLen.Set(float64(n))
+}
+
+func (m *Prometheus) InFlight(delta int) {
+	m.inFlight.Add(float64(delta))
+}
+
+func (m *Prometheus) ConfirmTxDuration(d time.Duration) {
+	m.confirmDuration.Observe(d.Seconds())
+}
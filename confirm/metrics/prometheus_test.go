@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+type client struct{}
+
+func (c *client) SendTx(ctx context.Context, tx interface{}) (string, error) {
+	return tx.(string), nil
+}
+
+func (c *client) ConfirmTx(ctx context.Context, hash string, confirmationBlocks uint64) error {
+	if hash == "0x02" {
+		return confirm.ErrTxFailed
+	}
+	return nil
+}
+
+func TestPrometheus(t *testing.T) {
+	var (
+		reg  = prometheus.NewRegistry()
+		done = make(chan struct{}, 2)
+	)
+
+	m, err := NewPrometheus(reg, "test")
+	require.NoError(t, err)
+
+	c := confirm.NewConfirmer(&client{}, 2, confirm.WithWorkers(1), confirm.WithConfirmationInterval(0), confirm.WithMetrics(m),
+		confirm.WithAfterTxConfirmed(func(h string) error {
+			done <- struct{}{}
+			return nil
+		}),
+		confirm.WithErrHandler(func(h string, err error) {
+			done <- struct{}{}
+		}))
+
+	err = c.Start(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, c.EnqueueTx(context.Background(), "0x01"))
+	require.NoError(t, c.EnqueueTx(context.Background(), "0x02"))
+
+	<-done
+	<-done
+
+	_, err = c.Shutdown(context.Background())
+	require.NoError(t, err)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.sent))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.confirmed))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.failed))
+	require.Equal(t, float64(0), testutil.ToFloat64(m.inFlight))
+	require.Equal(t, 1, testutil.CollectAndCount(m.latency))
+}
+
+func TestPrometheusNames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	_, err := NewPrometheus(reg, "a")
+	require.NoError(t, err)
+
+	_, err = NewPrometheus(reg, "b")
+	require.NoError(t, err)
+
+	// the same name conflicts
+	_, err = NewPrometheus(reg, "a")
+	require.Error(t, err)
+}
@@ -1,14 +1,31 @@
 package confirm
 
 import (
+	"context"
 	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	DEFAULT_CONFIEMATION_BLOCKS   = uint64(2)
-	DEFAULT_CONFIEMATION_INTERVAL = int64(1) // 1s
-	DEFAULT_WORKER_INTERVAL       = int64(10)
-	DEFAULT_TIMEOUT               = int64(60)
+	DEFAULT_CONFIEMATION_INTERVAL = int64(1)  // 1s
+	DEFAULT_WORKER_INTERVAL       = int64(10) // 10ms
+	DEFAULT_TIMEOUT               = int64(60) // 60s
+	DEFAULT_RESEND_WINDOW         = int64(60) // 60s
+	DEFAULT_MAX_RESENDS           = 3
+	DEFAULT_REPLACE_AFTER         = int64(0) // disabled
+	DEFAULT_MAX_REPLACEMENTS      = 3
+	DEFAULT_REORG_WATCH_WINDOW    = int64(0) // disabled
+	DEFAULT_MAX_AGE               = int64(0) // never expire
+	DEFAULT_STATUS_HISTORY        = 1024
+	DEFAULT_BATCH_SIZE            = 100
+	DEFAULT_RETRY_BACKOFF         = int64(1)  // 1s, doubled on each retry
+	DEFAULT_MAX_RETRY_BACKOFF     = int64(60) // 60s
+	DEFAULT_MAX_RETRIES           = 0         // retry endlessly
+	DEFAULT_MAX_HANDLER_ATTEMPTS  = 10
+	DEFAULT_QUEUE_SIZE            = 1 << 24
 )
 
 var (
@@ -23,10 +40,30 @@ func DefaultAfterTxConfirmed(hash string) error {
 	return nil
 }
 
-func DefaultErrHandler(hash string, err error) {
-	panic(err.Error())
+func DefaultAfterTxResent(hash string, attempts int) error {
+	return nil
+}
+
+func DefaultAfterTxReplaced(oldHash, newHash string) error {
+	return nil
 }
 
+func DefaultAfterTxReorged(hash string) error {
+	return nil
+}
+
+func DefaultAfterTxExpired(hash string, age time.Duration) error {
+	return nil
+}
+
+// DefaultAfterTxFailed passes the error through, so that reported to ErrHandler
+func DefaultAfterTxFailed(hash string, err error) error {
+	return err
+}
+
+// DefaultErrHandler does nothing, errors are logged by the logger
+func DefaultErrHandler(hash string, err error) {}
+
 type Opt interface {
 	Apply(c *Confirmer)
 }
@@ -41,26 +78,69 @@ func WithConfirmationBlock(b uint64) ConfirmationBlocks {
 	return ConfirmationBlocks(b)
 }
 
-// ConfirmationInterval
+// ConfirmationInterval in sec
+//
+// Deprecated: Use ConfirmationIntervalDuration instead.
 type ConfirmationInterval int64
 
 func (i ConfirmationInterval) Apply(c *Confirmer) {
-	c.confirmationInterval = int64(i)
+	c.confirmationInterval = time.Duration(i) * time.Second
 }
+
+// WithConfirmationInterval sets the confirmation interval in sec.
+//
+// Deprecated: Use WithConfirmationIntervalDuration instead.
 func WithConfirmationInterval(i int64) ConfirmationInterval {
 	return ConfirmationInterval(i)
 }
 
-// WorkerInterval
+// ConfirmationIntervalDuration
+type ConfirmationIntervalDuration time.Duration
+
+func (i ConfirmationIntervalDuration) Apply(c *Confirmer) {
+	c.confirmationInterval = time.Duration(i)
+}
+
+// WithConfirmationIntervalDuration sets how often a pending tx is rechecked.
+// Sub-second intervals suit chains with fast blocks.
+func WithConfirmationIntervalDuration(i time.Duration) ConfirmationIntervalDuration {
+	if i < 0 {
+		panic("confirmation interval should not be negative")
+	}
+	return ConfirmationIntervalDuration(i)
+}
+
+// WorkerInterval in millisec
+//
+// Deprecated: Use WorkerIntervalDuration instead.
 type WorkerInterval int64
 
 func (i WorkerInterval) Apply(c *Confirmer) {
-	c.workerInterval = int64(i)
+	c.workerInterval = time.Duration(i) * time.Millisecond
 }
+
+// WithWorkerInterval sets the worker interval in millisec.
+//
+// Deprecated: Use WithWorkerIntervalDuration instead.
 func WithWorkerInterval(i int64) WorkerInterval {
 	return WorkerInterval(i)
 }
 
+// WorkerIntervalDuration
+type WorkerIntervalDuration time.Duration
+
+func (i WorkerIntervalDuration) Apply(c *Confirmer) {
+	c.workerInterval = time.Duration(i)
+}
+
+// WithWorkerIntervalDuration sets the least interval of each worker checking due entries
+func WithWorkerIntervalDuration(i time.Duration) WorkerIntervalDuration {
+	if i < 0 {
+		panic("worker interval should not be negative")
+	}
+	return WorkerIntervalDuration(i)
+}
+
 // Workers
 type Workers int
 
@@ -74,12 +154,18 @@ func WithWorkers(w int) Workers {
 	return Workers(w)
 }
 
-// Timeout
+// Timeout in sec
+//
+// Deprecated: Use TimeoutDuration instead.
 type Timeout int64
 
 func (t Timeout) Apply(c *Confirmer) {
-	c.timeout = int64(t)
+	c.timeout = time.Duration(t) * time.Second
 }
+
+// WithTimeout sets the timeout in sec.
+//
+// Deprecated: Use WithTimeoutDuration instead.
 func WithTimeout(t int64) Timeout {
 	if t <= 0 {
 		panic("Timeout should be positive")
@@ -87,29 +173,644 @@ func WithTimeout(t int64) Timeout {
 	return Timeout(t)
 }
 
+// TimeoutDuration
+type TimeoutDuration time.Duration
+
+func (t TimeoutDuration) Apply(c *Confirmer) {
+	c.timeout = time.Duration(t)
+}
+
+// WithTimeoutDuration sets the time limit of each check by the client
+func WithTimeoutDuration(t time.Duration) TimeoutDuration {
+	if t <= 0 {
+		panic("Timeout should be positive")
+	}
+	return TimeoutDuration(t)
+}
+
+// ResendWindow in sec
+//
+// Deprecated: Use ResendWindowDuration instead.
+type ResendWindow int64
+
+func (w ResendWindow) Apply(c *Confirmer) {
+	c.resendWindow = time.Duration(w) * time.Second
+}
+
+// WithResendWindow sets the resend window in sec.
+//
+// Deprecated: Use WithResendWindowDuration instead.
+func WithResendWindow(w int64) ResendWindow {
+	if w < 0 {
+		panic("resend window should not be negative")
+	}
+	return ResendWindow(w)
+}
+
+// ResendWindowDuration
+type ResendWindowDuration time.Duration
+
+func (w ResendWindowDuration) Apply(c *Confirmer) {
+	c.resendWindow = time.Duration(w)
+}
+
+// WithResendWindowDuration sets how long a tx is allowed to be not found
+// before being resent. Zero disables resending.
+func WithResendWindowDuration(w time.Duration) ResendWindowDuration {
+	if w < 0 {
+		panic("resend window should not be negative")
+	}
+	return ResendWindowDuration(w)
+}
+
+// MaxResends
+type MaxResends int
+
+func (m MaxResends) Apply(c *Confirmer) {
+	c.maxResends = int(m)
+}
+func WithMaxResends(m int) MaxResends {
+	if m < 0 {
+		panic("max resends should not be negative")
+	}
+	return MaxResends(m)
+}
+
+// ReplaceAfter in sec
+//
+// Deprecated: Use ReplaceAfterDuration instead.
+type ReplaceAfter int64
+
+func (r ReplaceAfter) Apply(c *Confirmer) {
+	c.replaceAfter = time.Duration(r) * time.Second
+}
+
+// WithReplaceAfter sets the replace after in sec.
+//
+// Deprecated: Use WithReplaceAfterDuration instead.
+func WithReplaceAfter(r int64) ReplaceAfter {
+	if r < 0 {
+		panic("replace after should not be negative")
+	}
+	return ReplaceAfter(r)
+}
+
+// ReplaceAfterDuration
+type ReplaceAfterDuration time.Duration
+
+func (r ReplaceAfterDuration) Apply(c *Confirmer) {
+	c.replaceAfter = time.Duration(r)
+}
+
+// WithReplaceAfterDuration sets how long a tx is allowed to be unmined
+// before being replaced. Zero disables replacing.
+// Works only when the client implements Replacer.
+func WithReplaceAfterDuration(r time.Duration) ReplaceAfterDuration {
+	if r < 0 {
+		panic("replace after should not be negative")
+	}
+	return ReplaceAfterDuration(r)
+}
+
+// MaxReplacements
+type MaxReplacements int
+
+func (m MaxReplacements) Apply(c *Confirmer) {
+	c.maxReplacements = int(m)
+}
+func WithMaxReplacements(m int) MaxReplacements {
+	if m < 0 {
+		panic("max replacements should not be negative")
+	}
+	return MaxReplacements(m)
+}
+
+// ReorgWatchWindow in sec
+//
+// Deprecated: Use ReorgWatchWindowDuration instead.
+type ReorgWatchWindow int64
+
+func (w ReorgWatchWindow) Apply(c *Confirmer) {
+	c.reorgWatchWindow = time.Duration(w) * time.Second
+}
+
+// WithReorgWatchWindow sets the reorg watch window in sec.
+//
+// Deprecated: Use WithReorgWatchWindowDuration instead.
+func WithReorgWatchWindow(w int64) ReorgWatchWindow {
+	if w < 0 {
+		panic("reorg watch window should not be negative")
+	}
+	return ReorgWatchWindow(w)
+}
+
+// ReorgWatchWindowDuration
+type ReorgWatchWindowDuration time.Duration
+
+func (w ReorgWatchWindowDuration) Apply(c *Confirmer) {
+	c.reorgWatchWindow = time.Duration(w)
+}
+
+// WithReorgWatchWindowDuration sets how long a confirmed tx is kept watched for late reorgs.
+// Zero disables watching. Works only when the client implements BlockReporter.
+func WithReorgWatchWindowDuration(w time.Duration) ReorgWatchWindowDuration {
+	if w < 0 {
+		panic("reorg watch window should not be negative")
+	}
+	return ReorgWatchWindowDuration(w)
+}
+
+// MaxAge in sec
+//
+// Deprecated: Use MaxAgeDuration instead.
+type MaxAge int64
+
+func (a MaxAge) Apply(c *Confirmer) {
+	c.maxAge = time.Duration(a) * time.Second
+}
+
+// WithMaxAge sets the max age in sec.
+//
+// Deprecated: Use WithMaxAgeDuration instead.
+func WithMaxAge(a int64) MaxAge {
+	if a < 0 {
+		panic("max age should not be negative")
+	}
+	return MaxAge(a)
+}
+
+// MaxAgeDuration
+type MaxAgeDuration time.Duration
+
+func (a MaxAgeDuration) Apply(c *Confirmer) {
+	c.maxAge = time.Duration(a)
+}
+
+// WithMaxAgeDuration sets how long a tx is tracked since first enqueued.
+// Unconfirmed one older than this is removed as expired. Zero never expires.
+func WithMaxAgeDuration(a time.Duration) MaxAgeDuration {
+	if a < 0 {
+		panic("max age should not be negative")
+	}
+	return MaxAgeDuration(a)
+}
+
+// RetryBackoff in sec
+//
+// Deprecated: Use RetryBackoffDuration instead.
+type RetryBackoff int64
+
+func (b RetryBackoff) Apply(c *Confirmer) {
+	c.retryBackoff = time.Duration(b) * time.Second
+}
+
+// WithRetryBackoff sets the retry backoff in sec.
+//
+// Deprecated: Use WithRetryBackoffDuration instead.
+func WithRetryBackoff(b int64) RetryBackoff {
+	if b < 0 {
+		panic("retry backoff should not be negative")
+	}
+	return RetryBackoff(b)
+}
+
+// RetryBackoffDuration
+type RetryBackoffDuration time.Duration
+
+func (b RetryBackoffDuration) Apply(c *Confirmer) {
+	c.retryBackoff = time.Duration(b)
+}
+
+// WithRetryBackoffDuration sets the first delay of retrying after a transient or unknown error.
+// The delay is doubled on each retry up to the max retry backoff, with jitter.
+func WithRetryBackoffDuration(b time.Duration) RetryBackoffDuration {
+	if b < 0 {
+		panic("retry backoff should not be negative")
+	}
+	return RetryBackoffDuration(b)
+}
+
+// MaxRetryBackoff in sec
+//
+// Deprecated: Use MaxRetryBackoffDuration instead.
+type MaxRetryBackoff int64
+
+func (b MaxRetryBackoff) Apply(c *Confirmer) {
+	c.maxRetryBackoff = time.Duration(b) * time.Second
+}
+
+// WithMaxRetryBackoff sets the max retry backoff in sec.
+//
+// Deprecated: Use WithMaxRetryBackoffDuration instead.
+func WithMaxRetryBackoff(b int64) MaxRetryBackoff {
+	if b < 0 {
+		panic("max retry backoff should not be negative")
+	}
+	return MaxRetryBackoff(b)
+}
+
+// MaxRetryBackoffDuration
+type MaxRetryBackoffDuration time.Duration
+
+func (b MaxRetryBackoffDuration) Apply(c *Confirmer) {
+	c.maxRetryBackoff = time.Duration(b)
+}
+
+func WithMaxRetryBackoffDuration(b time.Duration) MaxRetryBackoffDuration {
+	if b < 0 {
+		panic("max retry backoff should not be negative")
+	}
+	return MaxRetryBackoffDuration(b)
+}
+
+// MaxRetries
+type MaxRetries int
+
+func (r MaxRetries) Apply(c *Confirmer) {
+	c.maxRetries = int(r)
+}
+
+// WithMaxRetries gives up the tx after the consecutive errors retried up to this.
+// Zero retries endlessly.
+func WithMaxRetries(r int) MaxRetries {
+	if r < 0 {
+		panic("max retries should not be negative")
+	}
+	return MaxRetries(r)
+}
+
+// MaxHandlerAttempts
+type MaxHandlerAttempts int
+
+func (a MaxHandlerAttempts) Apply(c *Confirmer) {
+	c.maxHandlerAttempts = int(a)
+}
+
+// WithMaxHandlerAttempts parks the confirmed tx as a dead letter
+// after AfterTxConfirmed failed this many times. Zero retries endlessly.
+func WithMaxHandlerAttempts(a int) MaxHandlerAttempts {
+	if a < 0 {
+		panic("max handler attempts should not be negative")
+	}
+	return MaxHandlerAttempts(a)
+}
+
+func (f Classifier) Apply(c *Confirmer) {
+	c.classify = f
+}
+
+// WithClassifier replaces the default classification of errors returned by ConfirmTx
+func WithClassifier(f func(error) ErrClass) Classifier {
+	if f == nil {
+		panic("classifier should not be nil")
+	}
+	return Classifier(f)
+}
+
+// StatusHistory
+type StatusHistory int
+
+func (h StatusHistory) Apply(c *Confirmer) {
+	c.statuses.historySize = int(h)
+}
+
+// WithStatusHistory sets how many finished txs are kept to be queried by Status
+func WithStatusHistory(h int) StatusHistory {
+	if h < 0 {
+		panic("status history should not be negative")
+	}
+	return StatusHistory(h)
+}
+
+// HeadDriven
+type HeadDriven bool
+
+func (h HeadDriven) Apply(c *Confirmer) {
+	c.headDriven = bool(h)
+}
+
+// WithHeadDriven checks entries on each new head instead of the confirmation interval.
+// Requires the client implements HeadSubscriber.
+func WithHeadDriven(h bool) HeadDriven {
+	return HeadDriven(h)
+}
+
+// AdaptiveInterval
+type AdaptiveInterval bool
+
+func (a AdaptiveInterval) Apply(c *Confirmer) {
+	c.adaptiveInterval = bool(a)
+}
+
+// WithAdaptiveInterval rechecks the mined tx when the confirmation blocks are expected
+// by the block time learned, instead of every confirmation interval, which is kept as the minimum.
+// The block time is learned from the heads reported by PendingError, or followed in WithHeadDriven.
+func WithAdaptiveInterval(a bool) AdaptiveInterval {
+	return AdaptiveInterval(a)
+}
+
+// BatchSize
+type BatchSize int
+
+func (b BatchSize) Apply(c *Confirmer) {
+	c.batchSize = int(b)
+}
+
+// WithBatchSize sets how many entries are confirmed at once,
+// when the client implements BatchClient
+func WithBatchSize(b int) BatchSize {
+	if b <= 0 {
+		panic("batch size should be positive")
+	}
+	return BatchSize(b)
+}
+
+// BlockingEnqueue
+type BlockingEnqueue bool
+
+func (b BlockingEnqueue) Apply(c *Confirmer) {
+	c.blockingEnqueue = bool(b)
+}
+
+// WithBlockingEnqueue makes EnqueueTx wait for the queue capacity until the ctx is done,
+// instead of returning ErrQueueFull
+func WithBlockingEnqueue(b bool) BlockingEnqueue {
+	return BlockingEnqueue(b)
+}
+
+// DrainOnShutdown
+type DrainOnShutdown bool
+
+func (d DrainOnShutdown) Apply(c *Confirmer) {
+	c.drainOnShutdown = bool(d)
+}
+
+// WithDrainOnShutdown checks due entries once more on shutdown
+func WithDrainOnShutdown(d bool) DrainOnShutdown {
+	return DrainOnShutdown(d)
+}
+
+// Logger
+type LoggerOpt struct {
+	l Logger
+}
+
+func (o LoggerOpt) Apply(c *Confirmer) {
+	c.logger = o.l
+}
+func WithLogger(l Logger) LoggerOpt {
+	if l == nil {
+		panic("logger should not be nil")
+	}
+	return LoggerOpt{l: l}
+}
+
+// Metrics
+type MetricsOpt struct {
+	m Metrics
+}
+
+func (o MetricsOpt) Apply(c *Confirmer) {
+	c.metrics = o.m
+}
+func WithMetrics(m Metrics) MetricsOpt {
+	if m == nil {
+		panic("metrics should not be nil")
+	}
+	return MetricsOpt{m: m}
+}
+
+// Tracing
+type TracerProviderOpt struct {
+	tp trace.TracerProvider
+}
+
+func (o TracerProviderOpt) Apply(c *Confirmer) {
+	c.tracer = o.tp.Tracer(TracerName)
+}
+func WithTracerProvider(tp trace.TracerProvider) TracerProviderOpt {
+	if tp == nil {
+		panic("tracer provider should not be nil")
+	}
+	return TracerProviderOpt{tp: tp}
+}
+
+// Store
+type StoreOpt struct {
+	s Store
+}
+
+func (o StoreOpt) Apply(c *Confirmer) {
+	c.store = o.s
+}
+func WithStore(s Store) StoreOpt {
+	if s == nil {
+		panic("store should not be nil")
+	}
+	return StoreOpt{s: s}
+}
+
+// Clock
+type ClockOpt struct {
+	c Clock
+}
+
+func (o ClockOpt) Apply(c *Confirmer) {
+	c.clock = o.c
+}
+
+// WithClock replaces the system clock, e.g. by the fake one of confirmtest
+func WithClock(c Clock) ClockOpt {
+	if c == nil {
+		panic("clock should not be nil")
+	}
+	return ClockOpt{c: c}
+}
+
+// DeadLetterStore
+type DeadLetterStoreOpt struct {
+	s Store
+}
+
+func (o DeadLetterStoreOpt) Apply(c *Confirmer) {
+	c.parked = o.s
+}
+
+// WithDeadLetterStore persists the dead letters in the store,
+// which should not share the keys with the one of WithStore
+func WithDeadLetterStore(s Store) DeadLetterStoreOpt {
+	if s == nil {
+		panic("dead letter store should not be nil")
+	}
+	return DeadLetterStoreOpt{s: s}
+}
+
 // AfterTxSent
 type AfterTxSent func(string) error
 
 func (f AfterTxSent) Apply(c *Confirmer) {
-	c.AfterTxSent = HashHandler(f)
+	c.AfterTxSent = HashEventHandler(f)
 }
 func WithAfterTxSent(f func(string) error) AfterTxSent {
 	return AfterTxSent(f)
 }
 
+// AfterTxSentEvent
+type AfterTxSentEvent func(context.Context, Event) error
+
+func (f AfterTxSentEvent) Apply(c *Confirmer) {
+	c.AfterTxSent = EventHandler(f)
+}
+
+// WithAfterTxSentEvent is WithAfterTxSent receiving the ctx of EnqueueTx and the event
+func WithAfterTxSentEvent(f func(context.Context, Event) error) AfterTxSentEvent {
+	return AfterTxSentEvent(f)
+}
+
 // AfterTxConfirmed
 type AfterTxConfirmed func(string) error
 
 func (f AfterTxConfirmed) Apply(c *Confirmer) {
-	c.AfterTxConfirmed = HashHandler(f)
+	c.AfterTxConfirmed = HashEventHandler(f)
 }
 func WithAfterTxConfirmed(f func(string) error) AfterTxConfirmed {
 	return AfterTxConfirmed(f)
 }
 
+// AfterTxConfirmedEvent
+type AfterTxConfirmedEvent func(context.Context, Event) error
+
+func (f AfterTxConfirmedEvent) Apply(c *Confirmer) {
+	c.AfterTxConfirmed = EventHandler(f)
+}
+
+// WithAfterTxConfirmedEvent is WithAfterTxConfirmed receiving the ctx of the recheck
+// and the event with the receipt
+func WithAfterTxConfirmedEvent(f func(context.Context, Event) error) AfterTxConfirmedEvent {
+	return AfterTxConfirmedEvent(f)
+}
+
+// AfterTxResent
+type AfterTxResent func(string, int) error
+
+func (f AfterTxResent) Apply(c *Confirmer) {
+	c.AfterTxResent = ResendHandler(f)
+}
+func WithAfterTxResent(f func(string, int) error) AfterTxResent {
+	return AfterTxResent(f)
+}
+
+// AfterTxReplaced
+type AfterTxReplaced func(string, string) error
+
+func (f AfterTxReplaced) Apply(c *Confirmer) {
+	c.AfterTxReplaced = ReplaceHandler(f)
+}
+func WithAfterTxReplaced(f func(oldHash, newHash string) error) AfterTxReplaced {
+	return AfterTxReplaced(f)
+}
+
+// AfterTxReorged
+type AfterTxReorged func(string) error
+
+func (f AfterTxReorged) Apply(c *Confirmer) {
+	c.AfterTxReorged = HashHandler(f)
+}
+func WithAfterTxReorged(f func(string) error) AfterTxReorged {
+	return AfterTxReorged(f)
+}
+
+// AfterTxExpired
+type AfterTxExpired func(string, time.Duration) error
+
+func (f AfterTxExpired) Apply(c *Confirmer) {
+	c.AfterTxExpired = ExpireHandler(f)
+}
+func WithAfterTxExpired(f func(hash string, age time.Duration) error) AfterTxExpired {
+	return AfterTxExpired(f)
+}
+
+// AfterTxFailed
+type AfterTxFailed func(string, error) error
+
+func (f AfterTxFailed) Apply(c *Confirmer) {
+	c.AfterTxFailed = FailHandler(f)
+}
+
+// WithAfterTxFailed handles txs failed by a permanent error, which are no longer tracked
+func WithAfterTxFailed(f func(hash string, err error) error) AfterTxFailed {
+	return AfterTxFailed(f)
+}
+
 func (f ErrHandler) Apply(c *Confirmer) {
-	c.ErrHandler = f
+	c.ErrHandler = ErrHashEventHandler(f)
 }
 func WithErrHandler(f func(string, error)) ErrHandler {
 	return ErrHandler(f)
 }
+
+// ErrEvent
+type ErrEvent func(context.Context, Event)
+
+func (f ErrEvent) Apply(c *Confirmer) {
+	c.ErrHandler = ErrEventHandler(f)
+}
+
+// WithErrEventHandler is WithErrHandler receiving the ctx of the worker
+// and the event with the error
+func WithErrEventHandler(f func(context.Context, Event)) ErrEvent {
+	return ErrEvent(f)
+}
+
+// TxOpt is an option applied to each enqueued tx,
+// which takes precedence over the confirmer's one
+type TxOpt interface {
+	ApplyTx(e *entry)
+}
+
+// TxConfirmationBlocks
+type TxConfirmationBlocks uint64
+
+func (b TxConfirmationBlocks) ApplyTx(e *entry) {
+	e.confirmationBlocks = uint64(b)
+}
+func WithTxConfirmationBlocks(b uint64) TxConfirmationBlocks {
+	if b == 0 {
+		panic("tx confirmation blocks should be positive")
+	}
+	return TxConfirmationBlocks(b)
+}
+
+// TxDeadline
+type TxDeadline int64
+
+func (d TxDeadline) ApplyTx(e *entry) {
+	e.deadline = int64(d)
+}
+
+// WithTxDeadline gives up confirming the tx unless confirmed by the deadline.
+// The tx is removed as expired, the same as exceeding the max age.
+func WithTxDeadline(d time.Time) TxDeadline {
+	return TxDeadline(d.UnixNano())
+}
+
+// TxMetadata
+type TxMetadata map[string]string
+
+// ApplyTx copies the metadata, not to change the one passed by events
+func (m TxMetadata) ApplyTx(e *entry) {
+	metadata := make(map[string]string, len(e.metadata)+len(m))
+	for k, v := range e.metadata {
+		metadata[k] = v
+	}
+	for k, v := range m {
+		metadata[k] = v
+	}
+	e.metadata = metadata
+}
+
+// WithTxMetadata attaches user data to the tx, which is persisted with the entry.
+// Keys and values longer than 65535 bytes are rejected by ErrMetadataTooLarge.
+func WithTxMetadata(m map[string]string) TxMetadata {
+	return TxMetadata(m)
+}
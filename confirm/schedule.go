@@ -0,0 +1,185 @@
+package confirm
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// scheduled is the entry waiting for its next check
+type scheduled struct {
+	e     *entry
+	at    int64  // unix nano, checked at or after
+	seq   uint64 // scheduled order, breaking ties
+	index int    // in the heap, -1 while held
+}
+
+// schedule orders entries by the next check time, so that workers
+// sleep until the earliest one instead of polling every entry.
+// Entries waiting for a new head are held aside until the head moves.
+type schedule struct {
+	sync.Mutex
+
+	items items
+	held  []*scheduled
+	keys  map[string]*scheduled
+	seq   uint64
+	head  uint64        // latest head flushed
+	wake  chan struct{} // closed when the earliest check moves ahead
+}
+
+func newSchedule() *schedule {
+	return &schedule{keys: make(map[string]*scheduled), wake: make(chan struct{})}
+}
+
+// push schedules the entry to be checked at the time.
+// The entry is owned by the schedule until popped, never modified meanwhile.
+func (s *schedule) push(e *entry, at int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pushLocked(&scheduled{e: e, at: at})
+}
+
+func (s *schedule) pushLocked(it *scheduled) {
+	s.keys[it.e.hash] = it
+	s.seq++
+	it.seq = s.seq
+	heap.Push(&s.items, it)
+
+	if s.items[0] == it {
+		s.notify()
+	}
+}
+
+// hold keeps the entry checked against the head until a newer one arrives
+func (s *schedule) hold(e *entry, head uint64, now int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	it := &scheduled{e: e, index: -1}
+	// the head moved while checking
+	if head < s.head {
+		it.at = now
+		s.pushLocked(it)
+		return
+	}
+	s.keys[e.hash] = it
+	s.held = append(s.held, it)
+}
+
+// flush schedules the held entries right away on the new head
+func (s *schedule) flush(head uint64, now int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.head = head
+	for _, it := range s.held {
+		it.at = now
+		s.pushLocked(it)
+	}
+	s.held = nil
+}
+
+// pop removes the earliest entry due by now
+func (s *schedule) pop(now int64) (*entry, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.items) == 0 || s.items[0].at > now {
+		return nil, false
+	}
+	it := heap.Pop(&s.items).(*scheduled)
+	if s.keys[it.e.hash] == it {
+		delete(s.keys, it.e.hash)
+	}
+	return it.e, true
+}
+
+// remove drops the entry of the key, false unless scheduled
+func (s *schedule) remove(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	it, ok := s.keys[key]
+	if !ok {
+		return false
+	}
+	delete(s.keys, key)
+
+	if it.index >= 0 {
+		heap.Remove(&s.items, it.index)
+		return true
+	}
+	for i, h := range s.held {
+		if h == it {
+			s.held = append(s.held[:i], s.held[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// due reports whether any entry is due by now
+func (s *schedule) due(now int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.items) > 0 && s.items[0].at <= now
+}
+
+// next returns the earliest check time, false if nothing is scheduled.
+// The channel is closed when an earlier one is scheduled.
+func (s *schedule) next() (int64, bool, <-chan struct{}) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.items) == 0 {
+		return 0, false, s.wake
+	}
+	return s.items[0].at, true, s.wake
+}
+
+func (s *schedule) Len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.items) + len(s.held)
+}
+
+func (s *schedule) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// items is the min-heap by the check time
+type items []*scheduled
+
+func (h items) Len() int { return len(h) }
+
+func (h items) Less(i, j int) bool {
+	if h[i].at != h[j].at {
+		return h[i].at < h[j].at
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h items) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *items) Push(x interface{}) {
+	it := x.(*scheduled)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *items) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
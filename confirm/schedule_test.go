@@ -0,0 +1,71 @@
+package confirm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	s := newSchedule()
+
+	_, ok, wake := s.next()
+	require.False(t, ok)
+
+	s.push(&entry{hash: "0x03"}, 3)
+	s.push(&entry{hash: "0x01"}, 1)
+	s.push(&entry{hash: "0x02"}, 1) // after 0x01 on the same time
+	require.Equal(t, 3, s.Len())
+
+	// woken by the earlier entry
+	select {
+	case <-wake:
+	default:
+		t.Fatal("not woken")
+	}
+	at, ok, _ := s.next()
+	require.True(t, ok)
+	require.Equal(t, int64(1), at)
+
+	_, ok = s.pop(0)
+	require.False(t, ok)
+	require.False(t, s.due(0))
+
+	for _, want := range []string{"0x01", "0x02"} {
+		e, ok := s.pop(2)
+		require.True(t, ok)
+		require.Equal(t, want, e.hash)
+	}
+	_, ok = s.pop(2)
+	require.False(t, ok)
+
+	// held until the head moves
+	s.hold(&entry{hash: "0x04"}, 10, 2)
+	require.Equal(t, 2, s.Len())
+	require.False(t, s.due(2))
+
+	s.flush(11, 2)
+	e, ok := s.pop(2)
+	require.True(t, ok)
+	require.Equal(t, "0x04", e.hash)
+
+	// checked against the old head, scheduled right away
+	s.hold(&entry{hash: "0x05"}, 10, 2)
+	e, ok = s.pop(2)
+	require.True(t, ok)
+	require.Equal(t, "0x05", e.hash)
+
+	// removed from both of scheduled and held
+	s.push(&entry{hash: "0x06"}, 3)
+	s.hold(&entry{hash: "0x07"}, 11, 3)
+	require.True(t, s.remove("0x06"))
+	require.True(t, s.remove("0x07"))
+	require.False(t, s.remove("0x07"))
+	require.Equal(t, 1, s.Len())
+
+	e, ok = s.pop(3)
+	require.True(t, ok)
+	require.Equal(t, "0x03", e.hash)
+	require.Equal(t, 0, s.Len())
+	require.False(t, s.remove("0x03"))
+}
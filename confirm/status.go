@@ -0,0 +1,217 @@
+package confirm
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type TxState int
+
+const (
+	TxQueued         TxState = iota // enqueued by hash, or resumed from the store
+	TxSent                          // sent by the confirmer, not checked yet
+	TxPending                       // checked, but not confirmed yet
+	TxConfirmed                     // confirmed, possibly watched for reorgs
+	TxFailed                        // failed on chain, or given up by an error
+	TxExpired                       // exceeded the max age or the deadline
+	TxHandlerPending                // confirmed, but AfterTxConfirmed is retried
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxQueued:
+		return "queued"
+	case TxSent:
+		return "sent"
+	case TxPending:
+		return "pending"
+	case TxConfirmed:
+		return "confirmed"
+	case TxFailed:
+		return "failed"
+	case TxExpired:
+		return "expired"
+	case TxHandlerPending:
+		return "handler pending"
+	default:
+		return "unknown"
+	}
+}
+
+// finished reports whether the tx reached the final state.
+// Confirmed one may be back to pending when reorged while watched.
+func (s TxState) finished() bool {
+	return s == TxConfirmed || s == TxFailed || s == TxExpired
+}
+
+type TxStatus struct {
+	Hash        string
+	State       TxState
+	EnqueuedAt  time.Time
+	CheckedAt   time.Time // zero until checked
+	Attempts    int       // times ConfirmTx called
+	LastErr     error
+	BlockNumber uint64 // reported by BlockReporter, or PendingError of ConfirmTx
+	Metadata    map[string]string
+}
+
+// statuses keeps the status of tracked txs,
+// and the latest finished ones up to the history size
+type statuses struct {
+	sync.Mutex
+
+	statuses    map[string]*TxStatus
+	history     []string // finished hashes, the oldest first
+	historySize int
+}
+
+func newStatuses(historySize int) *statuses {
+	return &statuses{
+		statuses:    make(map[string]*TxStatus),
+		historySize: historySize,
+	}
+}
+
+func (s *statuses) get(hash string) (TxStatus, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.statuses[hash]
+	if !ok {
+		return TxStatus{}, false
+	}
+	return *st, true
+}
+
+func (s *statuses) enqueued(e *entry, state TxState) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.statuses[e.hash] = &TxStatus{
+		Hash:        e.hash,
+		State:       state,
+		EnqueuedAt:  time.Unix(0, e.enqueuedAt),
+		Attempts:    int(e.attempts),
+		BlockNumber: e.blockNumber,
+		Metadata:    e.metadata,
+	}
+}
+
+// checked records the result of ConfirmTx
+func (s *statuses) checked(e *entry, now int64, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	st := s.getOrInit(e)
+	st.CheckedAt = time.Unix(0, now)
+	st.Attempts = int(e.attempts)
+	st.BlockNumber = e.blockNumber
+	st.LastErr = nil
+	if err != nil && !errors.Is(err, ErrTxConfirmPending) {
+		st.LastErr = err
+	}
+
+	st.State = TxPending
+	if err == nil {
+		st.State = TxConfirmed
+	}
+}
+
+func (s *statuses) handlerPending(e *entry, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	st := s.getOrInit(e)
+	st.State = TxHandlerPending
+	st.LastErr = err
+}
+
+func (s *statuses) reorged(e *entry) {
+	s.Lock()
+	defer s.Unlock()
+
+	st := s.getOrInit(e)
+	st.State = TxPending
+	st.BlockNumber = e.blockNumber
+}
+
+func (s *statuses) replaced(oldHash, newHash string) {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.statuses[oldHash]
+	if !ok {
+		return
+	}
+	delete(s.statuses, oldHash)
+	st.Hash = newHash
+	s.statuses[newHash] = st
+}
+
+// finish moves the tx to the history, which is evicted from the oldest
+func (s *statuses) finish(e *entry, state TxState, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	st := s.getOrInit(e)
+	st.State = state
+	if err != nil {
+		st.LastErr = err
+	}
+
+	s.history = append(s.history, e.hash)
+	for len(s.history) > s.historySize {
+		// skip if the hash is tracked again
+		if st, ok := s.statuses[s.history[0]]; ok && st.State.finished() {
+			delete(s.statuses, s.history[0])
+		}
+		s.history = s.history[1:]
+	}
+}
+
+func (s *statuses) remove(hash string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.statuses, hash)
+}
+
+func (s *statuses) pending(fn func(TxStatus) error) error {
+	s.Lock()
+	list := make([]TxStatus, 0, len(s.statuses))
+	for _, st := range s.statuses {
+		if st.State.finished() {
+			continue
+		}
+		list = append(list, *st)
+	}
+	s.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].EnqueuedAt.Before(list[j].EnqueuedAt)
+	})
+
+	for i := range list {
+		if err := fn(list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statuses) getOrInit(e *entry) *TxStatus {
+	st, ok := s.statuses[e.hash]
+	if !ok {
+		st = &TxStatus{
+			Hash:       e.hash,
+			State:      TxQueued,
+			EnqueuedAt: time.Unix(0, e.enqueuedAt),
+			Metadata:   e.metadata,
+		}
+		s.statuses[e.hash] = st
+	}
+	return st
+}
@@ -0,0 +1,111 @@
+package confirm
+
+import (
+	"sort"
+	"sync"
+)
+
+// Store persists pending entries so that they survive a restart.
+// Keys are tx hashes and values are the encoded queue entries.
+type Store interface {
+	Put(key string, value []byte) error
+	// Get returns ErrKeyNotFound unless stored
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	Iterate(fn func(key string, value []byte) error) error
+}
+
+var (
+	_ Store = (*nopStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+type nopStore struct{}
+
+func (s nopStore) Put(key string, value []byte) error {
+	return nil
+}
+
+func (s nopStore) Get(key string) ([]byte, error) {
+	return nil, ErrKeyNotFound
+}
+
+func (s nopStore) Delete(key string) error {
+	return nil
+}
+
+func (s nopStore) Iterate(fn func(key string, value []byte) error) error {
+	return nil
+}
+
+// MemoryStore is a Store kept in memory.
+// Useful for sharing entries between confirmers in tests.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	entries map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.entries[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Iterate(fn func(key string, value []byte) error) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		keys = append(keys, k)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s.mu.Lock()
+		v, ok := s.entries[k]
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+var (
+	_ confirm.Store = (*LevelDB)(nil)
+
+	DefaultPrefix = []byte(".confirmer")
+)
+
+// LevelDB is a file backed store for pending entries.
+// Every write is synced to disk, so that entries survive a crash.
+type LevelDB struct {
+	db     *leveldb.DB
+	prefix []byte
+	wo     *opt.WriteOptions
+}
+
+func NewLevelDB(path string) (*LevelDB, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "err OpenFile, path: %s", path)
+	}
+
+	return NewLevelDBWithDB(db, DefaultPrefix), nil
+}
+
+// NewLevelDBWithDB shares the db with other stores.
+// Entries are isolated by the prefix.
+func NewLevelDBWithDB(db *leveldb.DB, prefix []byte) *LevelDB {
+	return &LevelDB{
+		db:     db,
+		prefix: prefix,
+		wo:     &opt.WriteOptions{Sync: true},
+	}
+}
+
+func (s *LevelDB) Put(key string, value []byte) error {
+	return s.db.Put(s.key(key), value, s.wo)
+}
+
+func (s *LevelDB) Get(key string) ([]byte, error) {
+	value, err := s.db.Get(s.key(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, confirm.ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (s *LevelDB) Delete(key string) error {
+	return s.db.Delete(s.key(key), s.wo)
+}
+
+func (s *LevelDB) Iterate(fn func(key string, value []byte) error) error {
+	iter := s.db.NewIterator(util.BytesPrefix(s.prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var (
+			key   = string(iter.Key()[len(s.prefix):])
+			value = append([]byte{}, iter.Value()...)
+		)
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+
+	return iter.Error()
+}
+
+func (s *LevelDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *LevelDB) key(key string) []byte {
+	return append(append([]byte{}, s.prefix...), key...)
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tak1827/transaction-confirmer/confirm"
+)
+
+func TestLevelDB(t *testing.T) {
+	path := t.TempDir()
+
+	s, err := NewLevelDB(path)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put("0x01", []byte{1}))
+	require.NoError(t, s.Put("0x02", []byte{2}))
+	require.NoError(t, s.Delete("0x01"))
+	require.NoError(t, s.Close())
+
+	// reopen
+	s, err = NewLevelDB(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	got := make(map[string][]byte)
+	err = s.Iterate(func(key string, value []byte) error {
+		got[key] = value
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"0x02": {2}}, got)
+
+	value, err := s.Get("0x02")
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, value)
+	_, err = s.Get("0x01")
+	require.ErrorIs(t, err, confirm.ErrKeyNotFound)
+}
@@ -0,0 +1,263 @@
+package confirm
+
+import (
+	"context"
+	"sync"
+)
+
+// EventType tells the lifecycle event of the tx
+type EventType int
+
+const (
+	EventSent EventType = iota + 1
+	EventConfirmed
+	EventResent
+	EventReplaced
+	EventReorged
+	EventExpired
+	EventFailed
+	EventError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSent:
+		return "sent"
+	case EventConfirmed:
+		return "confirmed"
+	case EventResent:
+		return "resent"
+	case EventReplaced:
+		return "replaced"
+	case EventReorged:
+		return "reorged"
+	case EventExpired:
+		return "expired"
+	case EventFailed:
+		return "failed"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Overflow is the policy of a subscription when the buffer is full
+type Overflow int
+
+const (
+	OverflowBlock      Overflow = iota // waits for the subscriber, stalling the worker until its ctx is done
+	OverflowDropOldest                 // drops the oldest buffered event
+	OverflowError                      // closes the subscription with ErrSubscriptionOverflow
+)
+
+const DEFAULT_SUBSCRIPTION_BUFFER = 64
+
+// Filter selects the events sent to the subscription, nil selects all
+type Filter func(Event) bool
+
+// FilterTypes selects the events of the types
+func FilterTypes(types ...EventType) Filter {
+	return func(ev Event) bool {
+		for _, t := range types {
+			if ev.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Subscription receives the events published after subscribed
+type Subscription struct {
+	mu   sync.RWMutex // held for writing only when closing the channel
+	ch   chan Event
+	done chan struct{}
+	once sync.Once
+	err  error
+
+	filter   Filter
+	buffer   int
+	overflow Overflow
+	subs     *subscriptions
+}
+
+// SubscribeOpt is an option applied to each subscription
+type SubscribeOpt interface {
+	ApplySub(s *Subscription)
+}
+
+// SubscriptionBuffer
+type SubscriptionBuffer int
+
+func (b SubscriptionBuffer) ApplySub(s *Subscription) {
+	s.buffer = int(b)
+}
+func WithSubscriptionBuffer(b int) SubscriptionBuffer {
+	if b < 0 {
+		panic("subscription buffer should not be negative")
+	}
+	return SubscriptionBuffer(b)
+}
+
+func (o Overflow) ApplySub(s *Subscription) {
+	s.overflow = o
+}
+
+// WithOverflow sets the policy when the buffer is full, OverflowBlock by default
+func WithOverflow(o Overflow) Overflow {
+	return o
+}
+
+// Events returns the channel of the events, closed when unsubscribed
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Err returns ErrSubscriptionOverflow if closed by the overflow,
+// including the blocked event given up by the ctx of the worker
+func (s *Subscription) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// Unsubscribe stops the events and closes the channel
+func (s *Subscription) Unsubscribe() {
+	s.close(nil)
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		s.subs.remove(s)
+		// unblock senders first, then close after they leave
+		close(s.done)
+		s.mu.Lock()
+		s.err = err
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+func (s *Subscription) send(ctx context.Context, ev Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	switch s.overflow {
+	case OverflowDropOldest:
+		// nothing to drop without the buffer
+		if cap(s.ch) == 0 {
+			select {
+			case s.ch <- ev:
+			default:
+			}
+			return
+		}
+		for {
+			select {
+			case s.ch <- ev:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	case OverflowError:
+		select {
+		case s.ch <- ev:
+		default:
+			// can not close while sending
+			go s.close(ErrSubscriptionOverflow)
+		}
+	default:
+		// sent while buffered, even if the ctx is done
+		select {
+		case s.ch <- ev:
+			return
+		default:
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		case <-ctx.Done():
+			// told as the overflow, not to lose the event silently
+			go s.close(ErrSubscriptionOverflow)
+		}
+	}
+}
+
+type subscriptions struct {
+	sync.Mutex
+
+	subs map[*Subscription]struct{}
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+func (s *subscriptions) add(sub *Subscription) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.subs[sub] = struct{}{}
+}
+
+func (s *subscriptions) remove(sub *Subscription) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.subs, sub)
+}
+
+func (s *subscriptions) list() []*Subscription {
+	s.Lock()
+	defer s.Unlock()
+
+	list := make([]*Subscription, 0, len(s.subs))
+	for sub := range s.subs {
+		list = append(list, sub)
+	}
+	return list
+}
+
+// Subscribe returns the subscription of the events selected by the filter.
+// Subscriptions are independent of each other, and stay open across restarts until unsubscribed.
+func (c *Confirmer) Subscribe(filter Filter, opts ...SubscribeOpt) *Subscription {
+	s := Subscription{
+		done:   make(chan struct{}),
+		filter: filter,
+		buffer: DEFAULT_SUBSCRIPTION_BUFFER,
+		subs:   c.subs,
+	}
+
+	for i := range opts {
+		opts[i].ApplySub(&s)
+	}
+
+	s.ch = make(chan Event, s.buffer)
+	c.subs.add(&s)
+
+	return &s
+}
+
+// publish sends the event to every subscription selecting it
+func (c *Confirmer) publish(ctx context.Context, ev Event) {
+	for _, s := range c.subs.list() {
+		if s.filter != nil && !s.filter(ev) {
+			continue
+		}
+		s.send(ctx, ev)
+	}
+}
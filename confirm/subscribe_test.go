@@ -0,0 +1,98 @@
+package confirm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	var (
+		ctx = context.Background()
+		c   = NewConfirmer(&MockClient{}, 5, WithConfirmationInterval(0))
+		all = c.Subscribe(nil)
+		con = c.Subscribe(FilterTypes(EventConfirmed))
+	)
+
+	err := c.EnqueueTx(ctx, "0x01")
+	require.NoError(t, err)
+	_, err = c.DequeueTx(ctx)
+	require.NoError(t, err)
+
+	ev := <-all.Events()
+	require.Equal(t, EventSent, ev.Type)
+	ev = <-all.Events()
+	require.Equal(t, EventConfirmed, ev.Type)
+	require.Equal(t, "0x01", ev.Hash)
+
+	ev = <-con.Events()
+	require.Equal(t, EventConfirmed, ev.Type)
+	require.Len(t, con.Events(), 0)
+
+	con.Unsubscribe()
+	_, ok := <-con.Events()
+	require.False(t, ok)
+	require.NoError(t, con.Err())
+
+	// independent of the closed one
+	err = c.EnqueueTx(ctx, "0x02")
+	require.NoError(t, err)
+	ev = <-all.Events()
+	require.Equal(t, "0x02", ev.Hash)
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	var (
+		ctx = context.Background()
+		c   = NewConfirmer(&MockClient{}, 5)
+	)
+
+	drop := c.Subscribe(nil, WithSubscriptionBuffer(1), WithOverflow(OverflowDropOldest))
+	fail := c.Subscribe(nil, WithSubscriptionBuffer(1), WithOverflow(OverflowError))
+
+	c.publish(ctx, Event{Hash: "0x01"})
+	c.publish(ctx, Event{Hash: "0x02"})
+
+	ev := <-drop.Events()
+	require.Equal(t, "0x02", ev.Hash)
+
+	// the buffered one is still received before closed
+	ev = <-fail.Events()
+	require.Equal(t, "0x01", ev.Hash)
+	_, ok := <-fail.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, fail.Err(), ErrSubscriptionOverflow)
+	drop.Unsubscribe()
+
+	// blocks until received or unsubscribed
+	block := c.Subscribe(nil, WithSubscriptionBuffer(0))
+	sent := make(chan struct{})
+	go func() {
+		c.publish(ctx, Event{Hash: "0x03"})
+		c.publish(ctx, Event{Hash: "0x04"})
+		close(sent)
+	}()
+
+	ev = <-block.Events()
+	require.Equal(t, "0x03", ev.Hash)
+
+	select {
+	case <-sent:
+		t.Fatal("should block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	block.Unsubscribe()
+	<-sent
+
+	// closed by the overflow once given up
+	block = c.Subscribe(nil, WithSubscriptionBuffer(0))
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	c.publish(cctx, Event{Hash: "0x05"})
+	_, ok = <-block.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, block.Err(), ErrSubscriptionOverflow)
+}
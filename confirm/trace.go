@@ -0,0 +1,47 @@
+package confirm
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName = "github.com/tak1827/transaction-confirmer/confirm"
+
+const (
+	SpanEnqueueTx        = "EnqueueTx"
+	SpanEnqueueTxHash    = "EnqueueTxHash"
+	SpanSendTx           = "SendTx"
+	SpanRecheck          = "Recheck"
+	SpanConfirmTx        = "ConfirmTx"
+	SpanConfirmTxs       = "ConfirmTxs"
+	SpanAfterTxConfirmed = "AfterTxConfirmed"
+)
+
+const (
+	AttrHash    = attribute.Key("tx.hash")
+	AttrMined   = attribute.Key("tx.mined")
+	AttrAttempt = attribute.Key("tx.attempt")
+)
+
+// startRecheck starts the span of a recheck, parented to the span enqueued the entry.
+// Rechecks run in workers, so the parent is restored from the entry instead of the ctx.
+func (c *Confirmer) startRecheck(ctx context.Context, e *entry) (context.Context, trace.Span) {
+	if e.spanContext.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, e.spanContext)
+	}
+	return c.tracer.Start(ctx, SpanRecheck, trace.WithAttributes(AttrHash.String(e.hash), AttrAttempt.Int(int(e.attempts)+1)))
+}
+
+// endSpan ends the span, recording the error if any.
+// Not found or pending is the usual result of a recheck, so not recorded.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrTxNotFound) && !errors.Is(err, ErrTxConfirmPending) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
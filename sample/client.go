@@ -5,9 +5,11 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -19,16 +21,26 @@ import (
 
 const (
 	DefaultGasLimit = 21000
-	DefaultGasPrice = 0 // 1 gwai
+	DefaultGasPrice = 0  // 1 gwai
+	FeeBumpPercent  = 10 // minimum bump accepted by txpool
 )
 
-var _ confirm.Client = (*Client)(nil)
+var (
+	_ confirm.Client          = (*Client)(nil)
+	_ confirm.Replacer        = (*Client)(nil)
+	_ confirm.BlockReporter   = (*Client)(nil)
+	_ confirm.HeadSubscriber  = (*Client)(nil)
+	_ confirm.BatchClient     = (*Client)(nil)
+	_ confirm.ReceiptReporter = (*Client)(nil)
+)
 
 type Client struct {
 	Endpoint string
 
 	ethclient *ethclient.Client
 	rpcclient *rpc.Client
+	priv      *ecdsa.PrivateKey // for signing replacement
+	head      uint64            // latest head subscribed
 
 	GasPrice *big.Int
 }
@@ -81,11 +93,127 @@ func (c *Client) SendTx(ctx context.Context, tx interface{}) (string, error) {
 	return signedTx.Hash().Hex(), nil
 }
 
+func (c *Client) ReplaceTx(ctx context.Context, tx interface{}) (interface{}, error) {
+	if c.priv == nil {
+		return nil, errors.New("no signer for replacement")
+	}
+
+	var (
+		old    = tx.(*types.Transaction)
+		inner  types.TxData
+		signer types.Signer
+	)
+
+	switch old.Type() {
+	case types.LegacyTxType:
+		inner = &types.LegacyTx{
+			Nonce:    old.Nonce(),
+			GasPrice: bumpFee(old.GasPrice()),
+			Gas:      old.Gas(),
+			To:       old.To(),
+			Value:    old.Value(),
+			Data:     old.Data(),
+		}
+		signer = types.HomesteadSigner{}
+		if old.Protected() {
+			signer = types.NewEIP155Signer(old.ChainId())
+		}
+	case types.DynamicFeeTxType:
+		inner = &types.DynamicFeeTx{
+			ChainID:    old.ChainId(),
+			Nonce:      old.Nonce(),
+			GasTipCap:  bumpFee(old.GasTipCap()),
+			GasFeeCap:  bumpFee(old.GasFeeCap()),
+			Gas:        old.Gas(),
+			To:         old.To(),
+			Value:      old.Value(),
+			Data:       old.Data(),
+			AccessList: old.AccessList(),
+		}
+		signer = types.NewLondonSigner(old.ChainId())
+	default:
+		return nil, errors.Errorf("unsupported tx type: %d", old.Type())
+	}
+
+	replaced, err := types.SignNewTx(c.priv, signer, inner)
+	if err != nil {
+		return nil, errors.Wrap(err, "err SignNewTx")
+	}
+
+	return replaced, nil
+}
+
 func (c *Client) Receipt(ctx context.Context, hash string) (*types.Receipt, error) {
 	return c.ethclient.TransactionReceipt(ctx, common.HexToHash(hash))
 }
 
+func (c *Client) TxBlock(ctx context.Context, hash string) (uint64, string, error) {
+	recept, err := c.Receipt(ctx, hash)
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			return 0, "", confirm.ErrTxNotFound
+		}
+		return 0, "", errors.Wrap(err, "err TransactionReceipt")
+	}
+
+	return recept.BlockNumber.Uint64(), recept.BlockHash.Hex(), nil
+}
+
+func (c *Client) TxReceipt(ctx context.Context, hash string) (confirm.Receipt, error) {
+	recept, err := c.Receipt(ctx, hash)
+	if err != nil {
+		return confirm.Receipt{}, errors.Wrap(err, "err TransactionReceipt")
+	}
+
+	return confirm.Receipt{
+		BlockNumber: recept.BlockNumber.Uint64(),
+		BlockHash:   recept.BlockHash.Hex(),
+		GasUsed:     recept.GasUsed,
+	}, nil
+}
+
+// SubscribeHeads requires websocket endpoint
+func (c *Client) SubscribeHeads(ctx context.Context) (<-chan uint64, error) {
+	headers := make(chan *types.Header)
+	sub, err := c.ethclient.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "err SubscribeNewHead")
+	}
+
+	heads := make(chan uint64)
+	go func() {
+		defer close(heads)
+		defer sub.Unsubscribe()
+		defer atomic.StoreUint64(&c.head, 0)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Err():
+				return
+			case header := <-headers:
+				head := header.Number.Uint64()
+				atomic.StoreUint64(&c.head, head)
+
+				select {
+				case <-ctx.Done():
+					return
+				case heads <- head:
+				}
+			}
+		}
+	}()
+
+	return heads, nil
+}
+
 func (c *Client) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	// no need to fetch while subscribing
+	if head := atomic.LoadUint64(&c.head); head > 0 {
+		return head, nil
+	}
+
 	header, err := c.ethclient.HeaderByNumber(ctx, nil)
 	if err != nil {
 		return 0, err
@@ -111,13 +239,75 @@ func (c *Client) ConfirmTx(ctx context.Context, hash string, confirmationBlocks
 		return errors.Wrap(err, "err LatestBlockNumber")
 	}
 
-	if recept.BlockNumber.Uint64()+confirmationBlocks > block {
-		return confirm.ErrTxConfirmPending
+	return checkDepth(recept, confirmationBlocks, block)
+}
+
+// ConfirmTxs fetches receipts and the latest block number by a single batch call
+func (c *Client) ConfirmTxs(ctx context.Context, hashes []string, confirmationBlocks uint64) map[string]error {
+	var (
+		receipts = make([]*types.Receipt, len(hashes))
+		latest   hexutil.Uint64
+		batch    = make([]rpc.BatchElem, 0, len(hashes)+1)
+		errs     = make(map[string]error, len(hashes))
+	)
+
+	for i, hash := range hashes {
+		batch = append(batch, rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{common.HexToHash(hash)},
+			Result: &receipts[i],
+		})
+	}
+	batch = append(batch, rpc.BatchElem{
+		Method: "eth_blockNumber",
+		Result: &latest,
+	})
+
+	if err := c.rpcclient.BatchCallContext(ctx, batch); err != nil {
+		err = errors.Wrap(err, "err BatchCallContext")
+		for _, hash := range hashes {
+			errs[hash] = err
+		}
+		return errs
 	}
 
+	blockErr := batch[len(hashes)].Error
+
+	for i, hash := range hashes {
+		recept := receipts[i]
+		switch {
+		case batch[i].Error != nil:
+			errs[hash] = errors.Wrap(batch[i].Error, "err eth_getTransactionReceipt")
+		case recept == nil:
+			errs[hash] = confirm.ErrTxNotFound
+		case recept.Status != 1:
+			errs[hash] = confirm.ErrTxFailed
+		case blockErr != nil:
+			errs[hash] = errors.Wrap(blockErr, "err eth_blockNumber")
+		default:
+			errs[hash] = checkDepth(recept, confirmationBlocks, uint64(latest))
+		}
+	}
+
+	return errs
+}
+
+func checkDepth(recept *types.Receipt, confirmationBlocks, latest uint64) error {
+	if number := recept.BlockNumber.Uint64(); number+confirmationBlocks > latest {
+		return confirm.ConfirmPending(number, latest)
+	}
 	return nil
 }
 
+func bumpFee(fee *big.Int) *big.Int {
+	bump := new(big.Int).Mul(fee, big.NewInt(FeeBumpPercent))
+	bump.Div(bump, big.NewInt(100))
+	if bump.Sign() == 0 {
+		bump.SetInt64(1)
+	}
+	return bump.Add(bump, fee)
+}
+
 func GenerateAddr() (addr common.Address, err error) {
 	priv, err := crypto.GenerateKey()
 	if err != nil {
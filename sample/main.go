@@ -4,11 +4,14 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/tak1827/go-store/store"
 	"github.com/tak1827/transaction-confirmer/confirm"
+	"github.com/tak1827/transaction-confirmer/confirm/logger"
+	confirmstore "github.com/tak1827/transaction-confirmer/confirm/store"
 	"github.com/tak1827/transaction-confirmer/sample/log"
 	"github.com/tak1827/transaction-confirmer/sample/pb"
 )
@@ -16,6 +19,11 @@ import (
 var (
 	Endpoint = "http://localhost:8545"
 	PrivKey  = "d1c71e71b06e248c8dbe94d49ef6d6b0d64f5d71b1e33a0f39e14dadb070304a"
+
+	// pending txs are resumed from after restart
+	StorePath = ".confirmer"
+
+	ShutdownTimeout = 30 * time.Second
 )
 
 func main() {
@@ -30,22 +38,55 @@ func main() {
 	wallet, err := NewWallet(ctx, &client, PrivKey)
 	errHandler(err)
 
+	// sign replacements of stuck txs
+	client.priv = wallet.priv
+
+	pendingStore, err := confirmstore.NewLevelDB(StorePath)
+	errHandler(err)
+	defer pendingStore.Close()
+
 	sent := func(hash string) error {
 		log.Logger.Info().Msgf("tx sent, hash: %s", hash)
 		return nil
 	}
 
-	confirmed := func(hash string) error {
-		value, err := txStore.Get([]byte(hash))
+	// deleted by the handler, so that retried by the confirmer if failed
+	confirmed := func(ctx context.Context, ev confirm.Event) error {
+		return txStore.Delete([]byte(ev.Hash))
+	}
+
+	replaced := func(oldHash, newHash string) error {
+		value, err := txStore.Get([]byte(oldHash))
 		var t pb.Transaction
 		if err = t.Unmarshal(value); err != nil {
 			return err
 		}
-		log.Logger.Info().Msgf("tx confirmed, tx: %v", t)
-		return txStore.Delete([]byte(hash))
+		t.Id = newHash
+		if value, err = t.Marshal(); err != nil {
+			return err
+		}
+		if err = txStore.Put(t.StoreKey(), value); err != nil {
+			return err
+		}
+		log.Logger.Info().Msgf("tx replaced, hash: %s -> %s", oldHash, newHash)
+		return txStore.Delete([]byte(oldHash))
+	}
+
+	reorged := func(hash string) error {
+		log.Logger.Warn().Msgf("tx reorged, hash: %s", hash)
+		return nil
 	}
 
-	confirmer := confirm.NewConfirmer(&client, 100, confirm.WithWorkers(2), confirm.WithWorkerInterval(100), confirm.WithTimeout(15), confirm.WithAfterTxSent(sent), confirm.WithAfterTxConfirmed(confirmed))
+	confirmer := confirm.NewConfirmer(&client, 100, confirm.WithWorkers(2), confirm.WithWorkerIntervalDuration(100*time.Millisecond), confirm.WithTimeoutDuration(15*time.Second), confirm.WithBlockingEnqueue(true), confirm.WithStore(pendingStore), confirm.WithReplaceAfterDuration(30*time.Second), confirm.WithHeadDriven(strings.HasPrefix(Endpoint, "ws")), confirm.WithAfterTxSent(sent), confirm.WithAfterTxConfirmedEvent(confirmed), confirm.WithAfterTxReplaced(replaced), confirm.WithAfterTxReorged(reorged), confirm.WithLogger(logger.NewZerolog(log.Confirmer(""))))
+
+	// notified out of workers, not to stall confirming
+	sub := confirmer.Subscribe(confirm.FilterTypes(confirm.EventConfirmed), confirm.WithSubscriptionBuffer(1024), confirm.WithOverflow(confirm.OverflowDropOldest))
+	defer sub.Unsubscribe()
+	go func() {
+		for ev := range sub.Events() {
+			log.Logger.Info().Msgf("tx confirmed, hash: %s, block: %d, gas used: %d, latency: %s", ev.Hash, ev.BlockNumber, ev.GasUsed, ev.Latency)
+		}
+	}()
 
 	confirmer.Start(ctx)
 
@@ -59,7 +100,12 @@ func main() {
 		select {
 		case <-ch:
 			log.Logger.Info().Msg("shutting down...")
-			confirmer.Close(cancel)
+			sctx, scancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+			remaining, err := confirmer.Shutdown(sctx)
+			scancel()
+			cancel()
+			errHandler(err)
+			log.Logger.Info().Msgf("unconfirmed txs: %d", len(remaining))
 			return
 		case <-ticker.C:
 			tx := buildTx(&client, &wallet, txStore)